@@ -0,0 +1,321 @@
+package prover
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/scs"
+	stdplonk "github.com/consensys/gnark/std/recursion/plonk"
+	"github.com/reilabs/gnark-lean-extractor/abstractor"
+
+	"worldcoin/gnark-mbu/prover/poseidon"
+)
+
+// BatchKind selects which inner circuit's InputHash formula ProveAggregate
+// rederives for a batch: BatchKindInsertion hashes
+// StartIndex||PreRoot||PostRoot||IdComms (see computeInsertionInputHash),
+// BatchKindDeletion hashes DeletionIndices||PreRoot||PostRoot (see
+// computeDeletionInputHash). Every proof given to a single ProveAggregate
+// call must share the same kind, since they must also share a verifying key.
+type BatchKind uint8
+
+const (
+	BatchKindInsertion BatchKind = iota
+	BatchKindDeletion
+)
+
+func (k BatchKind) String() string {
+	switch k {
+	case BatchKindInsertion:
+		return "insertion"
+	case BatchKindDeletion:
+		return "deletion"
+	default:
+		return "unknown"
+	}
+}
+
+// AggregationPublicInputs is the public statement of a single inner batch
+// proof that ProveAggregate folds into the outer proof. StartIndex/IdComms
+// are only meaningful for BatchKindInsertion batches; DeletionIndices only
+// for BatchKindDeletion ones. All of them, together with PreRoot/PostRoot,
+// are exactly the fields the inner circuit hashed into InputHash, so
+// AggregationCircuit can rederive it rather than trust a copy.
+type AggregationPublicInputs struct {
+	PreRoot         big.Int
+	PostRoot        big.Int
+	InputHash       big.Int
+	StartIndex      big.Int
+	IdComms         []big.Int
+	DeletionIndices []big.Int
+}
+
+// publicInputHashCircuit stands in for the inner circuit (MbuCircuit or
+// DeletionMbuCircuit) when building the public witness stdplonk.ValueOfWitness
+// needs: both real inner circuits expose exactly one public variable, so a
+// witness assigned against this is indistinguishable, from the recursive
+// verifier's perspective, from one assigned against the real inner circuit.
+type publicInputHashCircuit struct {
+	InputHash frontend.Variable `gnark:",public"`
+}
+
+func (c *publicInputHashCircuit) Define(api frontend.API) error {
+	return nil
+}
+
+// AggregationCircuit verifies a sequence of inner PLONK batch proofs
+// (insertion or deletion, over BN254) inside a single outer circuit compiled
+// over BW6-761, whose scalar field matches BN254's base field. It asserts
+// that the batches chain, i.e. PostRoot_i == PreRoot_{i+1}, and recomputes
+// each inner InputHash from PreRoots[i]/PostRoots[i] and the rest of the
+// fields the inner circuit hashed it from, asserting equality against both
+// InputHashes[i] and the value bound in the inner proof — so PreRoots and
+// PostRoots are cryptographically tied to what the inner proof actually
+// attests, not merely copies a caller asserts match.
+//
+// Only FirstPreRoot, LastPostRoot, and InputHashesCommitment are public:
+// exposing every batch's PreRoot/PostRoot/InputHash as public witness
+// elements would make the on-chain verifier's public-input cost scale
+// linearly with the number of aggregated batches, defeating the point of
+// collapsing many batches into one succinct on-chain verification.
+// PreRoots/PostRoots/InputHashes stay private, bound to the two exposed
+// roots and to InputHashesCommitment via the in-circuit assertions below,
+// so none of the compression trades away soundness: a caller still can't
+// supply a PreRoots/PostRoots/InputHashes sequence unrelated to what the
+// inner proofs attest to and have it verify.
+type AggregationCircuit struct {
+	Proofs         []stdplonk.Proof[stdplonk.ScalarField, stdplonk.G1Element, stdplonk.G2Element]
+	VerifyingKeys  []stdplonk.VerifyingKey[stdplonk.ScalarField, stdplonk.G1Element, stdplonk.G2Element]
+	InnerWitnesses []stdplonk.Witness[stdplonk.ScalarField]
+
+	FirstPreRoot          frontend.Variable `gnark:",public"`
+	LastPostRoot          frontend.Variable `gnark:",public"`
+	InputHashesCommitment frontend.Variable `gnark:",public"`
+
+	PreRoots    []frontend.Variable
+	PostRoots   []frontend.Variable
+	InputHashes []frontend.Variable
+
+	StartIndices    []frontend.Variable
+	IdComms         [][]frontend.Variable
+	DeletionIndices [][]frontend.Variable
+
+	Kind        BatchKind
+	HashToField HashToField
+	NumProofs   int
+}
+
+func (circuit *AggregationCircuit) Define(api frontend.API) error {
+	verifier, err := stdplonk.NewVerifier[stdplonk.ScalarField, stdplonk.G1Element, stdplonk.G2Element, stdplonk.GtElement](api)
+	if err != nil {
+		return fmt.Errorf("instantiating recursive plonk verifier: %w", err)
+	}
+
+	for i := 0; i < circuit.NumProofs; i++ {
+		// The chain constraint: this batch's PreRoot must be the previous
+		// batch's PostRoot, so the outer proof attests to one contiguous
+		// sequence of tree transitions rather than N unrelated ones.
+		if i > 0 {
+			api.AssertIsEqual(circuit.PreRoots[i], circuit.PostRoots[i-1])
+		}
+
+		var recomputed frontend.Variable
+		switch circuit.Kind {
+		case BatchKindInsertion:
+			recomputed, err = computeInsertionInputHash(api, circuit.HashToField, circuit.StartIndices[i], circuit.PreRoots[i], circuit.PostRoots[i], circuit.IdComms[i])
+		case BatchKindDeletion:
+			recomputed, err = computeDeletionInputHash(api, circuit.HashToField, circuit.DeletionIndices[i], circuit.PreRoots[i], circuit.PostRoots[i])
+		default:
+			err = fmt.Errorf("unknown batch kind: %d", circuit.Kind)
+		}
+		if err != nil {
+			return fmt.Errorf("recomputing input hash %d: %w", i, err)
+		}
+
+		// Tying PreRoots[i]/PostRoots[i] to a value recomputed the same way
+		// the inner circuit computed InputHash, and that value to both
+		// InputHashes[i] and the witness element the recursive verifier is
+		// about to check, is what rules out a caller supplying PreRoots/
+		// PostRoots unrelated to the batch the inner proof actually covers.
+		api.AssertIsEqual(recomputed, circuit.InputHashes[i])
+		api.AssertIsEqual(circuit.InnerWitnesses[i].Public[0], circuit.InputHashes[i])
+
+		if err := verifier.AssertProof(circuit.VerifyingKeys[i], circuit.Proofs[i], circuit.InnerWitnesses[i]); err != nil {
+			return fmt.Errorf("verifying inner proof %d: %w", i, err)
+		}
+	}
+
+	// Bind the two public roots to the ends of the private chain, and the
+	// public commitment to the private per-batch InputHashes via
+	// PoseidonFold, the same field-element folding InputHash itself uses
+	// under HashToFieldPoseidon (see hash_to_field.go) — chosen here
+	// regardless of circuit.HashToField since this commitment is purely an
+	// internal binding device, never exposed to an on-chain hashToField
+	// caller the way InputHash is. This is what lets FirstPreRoot/
+	// LastPostRoot/InputHashesCommitment stand in for the full PreRoots/
+	// PostRoots/InputHashes arrays without a caller being able to swap in an
+	// unrelated chain that happens to share the same two endpoints.
+	api.AssertIsEqual(circuit.FirstPreRoot, circuit.PreRoots[0])
+	api.AssertIsEqual(circuit.LastPostRoot, circuit.PostRoots[circuit.NumProofs-1])
+
+	commitment := abstractor.CallGadget(api, PoseidonFold{Elements: circuit.InputHashes})[0]
+	api.AssertIsEqual(circuit.InputHashesCommitment, commitment)
+
+	return nil
+}
+
+// aggregationCircuit builds the assigned AggregationCircuit for proofs and
+// publicInputs against ps's verifying key. It is split out of ProveAggregate
+// so callers that need to size a universal SRS ahead of time (compiling this
+// same circuit shape themselves) don't have to duplicate the assignment
+// logic to get an identical constraint system.
+func (ps *ProvingSystem) aggregationCircuit(proofs []*Proof, publicInputs []AggregationPublicInputs) (*AggregationCircuit, error) {
+	innerProofs := make([]stdplonk.Proof[stdplonk.ScalarField, stdplonk.G1Element, stdplonk.G2Element], len(proofs))
+	innerVks := make([]stdplonk.VerifyingKey[stdplonk.ScalarField, stdplonk.G1Element, stdplonk.G2Element], len(proofs))
+	innerWitnesses := make([]stdplonk.Witness[stdplonk.ScalarField], len(proofs))
+	for i, p := range proofs {
+		if p.Backend != BackendPLONK {
+			return nil, fmt.Errorf("proof %d is not a PLONK proof", i)
+		}
+		ip, err := stdplonk.ValueOfProof[stdplonk.ScalarField, stdplonk.G1Element, stdplonk.G2Element](p.PlonkProof)
+		if err != nil {
+			return nil, fmt.Errorf("converting proof %d for recursion: %w", i, err)
+		}
+		innerProofs[i] = ip
+
+		iv, err := stdplonk.ValueOfVerifyingKey[stdplonk.ScalarField, stdplonk.G1Element, stdplonk.G2Element](ps.Plonk.VerifyingKey)
+		if err != nil {
+			return nil, fmt.Errorf("converting verifying key %d for recursion: %w", i, err)
+		}
+		innerVks[i] = iv
+
+		// The recursive verifier only ever reads the inner circuit's public
+		// inputs out of InnerWitnesses, so building it from a bare
+		// public-input assignment (rather than the full inner circuit
+		// witness) is enough to bind circuit.InnerWitnesses[i].Public[0] to
+		// the InputHash the real proof was produced against.
+		innerAssignment := &publicInputHashCircuit{InputHash: publicInputs[i].InputHash}
+		innerWitness, err := frontend.NewWitness(innerAssignment, ecc.BN254.ScalarField(), frontend.PublicOnly())
+		if err != nil {
+			return nil, fmt.Errorf("building public witness for proof %d: %w", i, err)
+		}
+		iw, err := stdplonk.ValueOfWitness[stdplonk.ScalarField](innerWitness)
+		if err != nil {
+			return nil, fmt.Errorf("converting witness %d for recursion: %w", i, err)
+		}
+		innerWitnesses[i] = iw
+	}
+
+	circuit := &AggregationCircuit{
+		Proofs:         innerProofs,
+		VerifyingKeys:  innerVks,
+		InnerWitnesses: innerWitnesses,
+		PreRoots:       make([]frontend.Variable, len(proofs)),
+		PostRoots:      make([]frontend.Variable, len(proofs)),
+		InputHashes:    make([]frontend.Variable, len(proofs)),
+		Kind:           ps.Kind,
+		HashToField:    ps.HashToField,
+		NumProofs:      len(proofs),
+	}
+
+	if ps.Kind == BatchKindInsertion {
+		circuit.StartIndices = make([]frontend.Variable, len(proofs))
+		circuit.IdComms = make([][]frontend.Variable, len(proofs))
+	} else {
+		circuit.DeletionIndices = make([][]frontend.Variable, len(proofs))
+	}
+
+	for i, pi := range publicInputs {
+		circuit.PreRoots[i] = pi.PreRoot
+		circuit.PostRoots[i] = pi.PostRoot
+		circuit.InputHashes[i] = pi.InputHash
+
+		if ps.Kind == BatchKindInsertion {
+			circuit.StartIndices[i] = pi.StartIndex
+			idComms := make([]frontend.Variable, len(pi.IdComms))
+			for j := range pi.IdComms {
+				idComms[j] = pi.IdComms[j]
+			}
+			circuit.IdComms[i] = idComms
+		} else {
+			deletionIndices := make([]frontend.Variable, len(pi.DeletionIndices))
+			for j := range pi.DeletionIndices {
+				deletionIndices[j] = pi.DeletionIndices[j]
+			}
+			circuit.DeletionIndices[i] = deletionIndices
+		}
+	}
+
+	circuit.FirstPreRoot = publicInputs[0].PreRoot
+	circuit.LastPostRoot = publicInputs[len(publicInputs)-1].PostRoot
+
+	commitment := &publicInputs[0].InputHash
+	for i := 1; i < len(publicInputs); i++ {
+		commitment = poseidon.Hash(commitment, &publicInputs[i].InputHash)
+	}
+	circuit.InputHashesCommitment = *commitment
+
+	return circuit, nil
+}
+
+// ProveAggregate collapses a sequence of batch proofs, produced by ps against
+// a PLONK-backed ProvingSystem, into a single succinct proof attesting to the
+// whole chain PreRoot_0 -> PostRoot_(n-1). ps.Backend must be BackendPLONK:
+// the recursive verifier gadget only supports PLONK inner proofs. It also
+// returns the outer verifying key, generated fresh by plonk.Setup over the
+// outer circuit and the universal SRS, since the returned proof is
+// meaningless without it.
+// srsPath is a ceremony-derived universal SRS for BW6-761, sized large
+// enough for the outer aggregation circuit; see universalSRS.
+func (ps *ProvingSystem) ProveAggregate(proofs []*Proof, publicInputs []AggregationPublicInputs, srsPath string) (*Proof, plonk.VerifyingKey, error) {
+	if ps.Backend != BackendPLONK {
+		return nil, nil, fmt.Errorf("aggregation requires a PLONK-backed proving system, got %s", ps.Backend)
+	}
+	if len(proofs) != len(publicInputs) {
+		return nil, nil, fmt.Errorf("got %d proofs but %d public inputs", len(proofs), len(publicInputs))
+	}
+	if len(proofs) == 0 {
+		return nil, nil, fmt.Errorf("no proofs to aggregate")
+	}
+	for i := 1; i < len(publicInputs); i++ {
+		if publicInputs[i-1].PostRoot.Cmp(&publicInputs[i].PreRoot) != 0 {
+			return nil, nil, fmt.Errorf("batch %d does not chain onto batch %d: PostRoot != PreRoot", i-1, i)
+		}
+	}
+
+	circuit, err := ps.aggregationCircuit(proofs, publicInputs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The outer circuit is compiled over BW6-761 so that its scalar field
+	// equals BN254's base field, letting it verify BN254 PLONK proofs
+	// without an expensive non-native field emulation of the pairing.
+	ccs, err := frontend.Compile(ecc.BW6_761.ScalarField(), scs.NewBuilder, circuit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("compiling aggregation circuit: %w", err)
+	}
+	srs, srsLagrange, err := universalSRS(0, uint32(len(proofs)), ecc.BW6_761, srsPath, ccs)
+	if err != nil {
+		return nil, nil, err
+	}
+	pk, vk, err := plonk.Setup(ccs, srs, srsLagrange)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	witness, err := frontend.NewWitness(circuit, ecc.BW6_761.ScalarField())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	proof, err := plonk.Prove(ccs, pk, witness)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &Proof{Backend: BackendPLONK, PlonkProof: proof}, vk, nil
+}
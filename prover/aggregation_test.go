@@ -0,0 +1,163 @@
+package prover
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/scs"
+
+	"worldcoin/gnark-mbu/prover/poseidon"
+)
+
+// TestProveAggregateRoundTrip exercises ProveAggregate against a single real
+// inner PLONK proof. Before InnerWitnesses was populated from the proof's
+// real InputHash, circuit.InnerWitnesses[i].Public[0] was always the zero
+// value, so this would either panic on an empty witness or silently verify
+// against a witness disconnected from the proof it was meant to describe.
+func TestProveAggregateRoundTrip(t *testing.T) {
+	const depth = 2
+	const batchSize = 1
+
+	innerCCS, err := BuildSCSInsertion(depth, batchSize)
+	if err != nil {
+		t.Fatalf("BuildSCSInsertion: %v", err)
+	}
+	innerSRSPath := writeUnsafeTestSRS(t, innerCCS)
+
+	ps, err := SetupInsertion(depth, batchSize, BackendPLONK, false, HashToFieldKeccak256BE, innerSRSPath)
+	if err != nil {
+		t.Fatalf("SetupInsertion: %v", err)
+	}
+
+	emptySubtree := poseidon.Hash(big.NewInt(0), big.NewInt(0))
+	idComm := big.NewInt(1)
+
+	params := &InsertionParameters{
+		StartIndex:   0,
+		PreRoot:      *poseidon.Hash(emptySubtree, emptySubtree),
+		PostRoot:     *poseidon.Hash(poseidon.Hash(idComm, big.NewInt(0)), emptySubtree),
+		IdComms:      []big.Int{*idComm},
+		MerkleProofs: [][]big.Int{{*big.NewInt(0), *emptySubtree}},
+	}
+	if err := params.ComputeInputHashInsertion(HashToFieldKeccak256BE); err != nil {
+		t.Fatalf("ComputeInputHashInsertion: %v", err)
+	}
+
+	innerProof, err := ps.ProveInsertion(params)
+	if err != nil {
+		t.Fatalf("ProveInsertion: %v", err)
+	}
+
+	aggPublicInputs := []AggregationPublicInputs{{
+		PreRoot:    params.PreRoot,
+		PostRoot:   params.PostRoot,
+		InputHash:  params.InputHash,
+		StartIndex: *big.NewInt(int64(params.StartIndex)),
+		IdComms:    params.IdComms,
+	}}
+
+	// Compile the same aggregation circuit shape ourselves purely to size a
+	// test SRS for it; ProveAggregate will compile an identical circuit and
+	// load its SRS from the file written here.
+	outerCircuit, err := ps.aggregationCircuit([]*Proof{innerProof}, aggPublicInputs)
+	if err != nil {
+		t.Fatalf("aggregationCircuit: %v", err)
+	}
+	outerCCS, err := frontend.Compile(ecc.BW6_761.ScalarField(), scs.NewBuilder, outerCircuit)
+	if err != nil {
+		t.Fatalf("compiling outer circuit: %v", err)
+	}
+	outerSRSPath := writeUnsafeTestSRS(t, outerCCS)
+
+	proof, vk, err := ps.ProveAggregate([]*Proof{innerProof}, aggPublicInputs, outerSRSPath)
+	if err != nil {
+		t.Fatalf("ProveAggregate: %v", err)
+	}
+	if vk == nil {
+		t.Fatal("ProveAggregate returned a nil outer verifying key")
+	}
+
+	// A prover returning no error only shows plonk.Prove was satisfied with
+	// the witness ProveAggregate built; it says nothing about whether
+	// AggregationCircuit.Define actually constrains what it claims to. Only
+	// an independent plonk.Verify against the real outer proof and a public
+	// witness built the same way a verifier would build one closes that gap.
+	outerWitness, err := frontend.NewWitness(outerCircuit, ecc.BW6_761.ScalarField())
+	if err != nil {
+		t.Fatalf("building outer witness: %v", err)
+	}
+	outerPublicWitness, err := outerWitness.Public()
+	if err != nil {
+		t.Fatalf("deriving public witness: %v", err)
+	}
+	if err := plonk.Verify(proof.PlonkProof, vk, outerPublicWitness); err != nil {
+		t.Fatalf("plonk.Verify: %v", err)
+	}
+}
+
+// TestProveAggregateRejectsTamperedInputHash guards against
+// AggregationCircuit.Define accepting an InputHashes[i] that wasn't actually
+// recomputed from PreRoots[i]/PostRoots[i]/the rest of the batch's fields:
+// without the AssertIsEqual this commit's sibling fix added, a caller could
+// hand ProveAggregate an InputHash disconnected from what the inner proof
+// attests to and still get a proof out.
+func TestProveAggregateRejectsTamperedInputHash(t *testing.T) {
+	const depth = 2
+	const batchSize = 1
+
+	innerCCS, err := BuildSCSInsertion(depth, batchSize)
+	if err != nil {
+		t.Fatalf("BuildSCSInsertion: %v", err)
+	}
+	innerSRSPath := writeUnsafeTestSRS(t, innerCCS)
+
+	ps, err := SetupInsertion(depth, batchSize, BackendPLONK, false, HashToFieldKeccak256BE, innerSRSPath)
+	if err != nil {
+		t.Fatalf("SetupInsertion: %v", err)
+	}
+
+	emptySubtree := poseidon.Hash(big.NewInt(0), big.NewInt(0))
+	idComm := big.NewInt(1)
+
+	params := &InsertionParameters{
+		StartIndex:   0,
+		PreRoot:      *poseidon.Hash(emptySubtree, emptySubtree),
+		PostRoot:     *poseidon.Hash(poseidon.Hash(idComm, big.NewInt(0)), emptySubtree),
+		IdComms:      []big.Int{*idComm},
+		MerkleProofs: [][]big.Int{{*big.NewInt(0), *emptySubtree}},
+	}
+	if err := params.ComputeInputHashInsertion(HashToFieldKeccak256BE); err != nil {
+		t.Fatalf("ComputeInputHashInsertion: %v", err)
+	}
+
+	innerProof, err := ps.ProveInsertion(params)
+	if err != nil {
+		t.Fatalf("ProveInsertion: %v", err)
+	}
+
+	tamperedInputHash := new(big.Int).Add(&params.InputHash, big.NewInt(1))
+	aggPublicInputs := []AggregationPublicInputs{{
+		PreRoot:    params.PreRoot,
+		PostRoot:   params.PostRoot,
+		InputHash:  *tamperedInputHash,
+		StartIndex: *big.NewInt(int64(params.StartIndex)),
+		IdComms:    params.IdComms,
+	}}
+
+	outerCircuit, err := ps.aggregationCircuit([]*Proof{innerProof}, aggPublicInputs)
+	if err != nil {
+		t.Fatalf("aggregationCircuit: %v", err)
+	}
+	outerCCS, err := frontend.Compile(ecc.BW6_761.ScalarField(), scs.NewBuilder, outerCircuit)
+	if err != nil {
+		t.Fatalf("compiling outer circuit: %v", err)
+	}
+	outerSRSPath := writeUnsafeTestSRS(t, outerCCS)
+
+	if _, _, err := ps.ProveAggregate([]*Proof{innerProof}, aggPublicInputs, outerSRSPath); err == nil {
+		t.Fatal("ProveAggregate succeeded with an InputHash that doesn't match the batch it was paired with")
+	}
+}
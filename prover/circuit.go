@@ -2,8 +2,6 @@ package prover
 
 import (
 	"strconv"
-	"worldcoin/gnark-mbu/prover/keccak"
-	"worldcoin/gnark-mbu/prover/poseidon"
 
 	"github.com/consensys/gnark/frontend"
 	"github.com/reilabs/gnark-lean-extractor/abstractor"
@@ -26,6 +24,15 @@ type MbuCircuit struct {
 
 	BatchSize int
 	Depth     int
+
+	// UseGKR routes the batch's Poseidon2 evaluations through a GKR sumcheck
+	// instance instead of proving each one as its own set of R1CS
+	// constraints. Off by default; InputHash is identical either way.
+	UseGKR bool
+
+	// HashToField selects how InputHash is derived from the fields above.
+	// Zero value is HashToFieldKeccak256BE, matching historical behaviour.
+	HashToField HashToField
 }
 
 type bitPatternLengthError struct {
@@ -40,25 +47,33 @@ type ProofRound struct {
 	Direction frontend.Variable
 	Hash      frontend.Variable
 	Sibling   frontend.Variable
+
+	Hasher merkleHasher
 }
 
 func (gadget ProofRound) DefineGadget(api abstractor.API) []frontend.Variable {
 	api.AssertIsBoolean(gadget.Direction)
 	d1 := api.Select(gadget.Direction, gadget.Hash, gadget.Sibling)
 	d2 := api.Select(gadget.Direction, gadget.Sibling, gadget.Hash)
-	sum := api.Call(poseidon.Poseidon2{In1: d1, In2: d2})[0]
+	hasher := gadget.Hasher
+	if hasher == nil {
+		hasher = r1csMerkleHasher{}
+	}
+	sum := hasher.Hash(api, d1, d2)
 	return []frontend.Variable{sum}
 }
 
 type VerifyProof struct {
 	Proof []frontend.Variable
 	Path  []frontend.Variable
+
+	Hasher merkleHasher
 }
 
 func (gadget VerifyProof) DefineGadget(api abstractor.API) []frontend.Variable {
 	sum := gadget.Proof[0]
 	for i := 1; i < len(gadget.Proof); i++ {
-		sum = api.Call(ProofRound{Direction: gadget.Path[i-1], Hash: gadget.Proof[i], Sibling: sum})[0]
+		sum = api.Call(ProofRound{Direction: gadget.Path[i-1], Hash: gadget.Proof[i], Sibling: sum, Hasher: gadget.Hasher})[0]
 	}
 	return []frontend.Variable{sum}
 }
@@ -72,6 +87,8 @@ type InsertionProof struct {
 
 	BatchSize int
 	Depth     int
+
+	Hasher merkleHasher
 }
 
 func (gadget InsertionProof) DefineGadget(api abstractor.API) []frontend.Variable {
@@ -87,12 +104,12 @@ func (gadget InsertionProof) DefineGadget(api abstractor.API) []frontend.Variabl
 		// len(circuit.IdComms) === circuit.BatchSize
 		// Verify proof for empty leaf.
 		proof := append([]frontend.Variable{emptyLeaf}, gadget.MerkleProofs[i][:]...)
-		root := api.Call(VerifyProof{Proof: proof, Path: currentPath})[0]
+		root := api.Call(VerifyProof{Proof: proof, Path: currentPath, Hasher: gadget.Hasher})[0]
 		api.AssertIsEqual(root, prevRoot)
 
 		// Verify proof for idComm.
 		proof = append([]frontend.Variable{gadget.IdComms[i]}, gadget.MerkleProofs[i][:]...)
-		root = api.Call(VerifyProof{Proof: proof, Path: currentPath})[0]
+		root = api.Call(VerifyProof{Proof: proof, Path: currentPath, Hasher: gadget.Hasher})[0]
 
 		// Set root for next iteration.
 		prevRoot = root
@@ -154,56 +171,73 @@ func FromBinaryBigEndian(bitsBigEndian []frontend.Variable, api frontend.API) (v
 	return api.FromBinary(bitsLittleEndian...), nil
 }
 
-func (circuit *MbuCircuit) Define(api frontend.API) error {
-	// Hash private inputs.
-	// We keccak hash all input to save verification gas. Inputs are arranged as follows:
-	// StartIndex || PreRoot || PostRoot || IdComms[0] || IdComms[1] || ... || IdComms[batchSize-1]
-	//     32	  ||   256   ||   256    ||    256     ||    256     || ... ||     256 bits
-
-	kh := keccak.NewKeccak256(api, (circuit.BatchSize+2)*256+32)
+// computeInsertionInputHash computes the InputHash MbuCircuit checks, from
+// the same fields, under strategy. AggregationCircuit calls this too, so
+// that it can rederive InputHash_i in-circuit instead of trusting a
+// caller-supplied copy that was never tied to PreRoots[i]/PostRoots[i].
+//
+// Inputs are arranged as follows:
+// StartIndex || PreRoot || PostRoot || IdComms[0] || IdComms[1] || ... || IdComms[batchSize-1]
+//     32	  ||   256   ||   256    ||    256     ||    256     || ... ||     256 bits
+//
+// HashToFieldKeccak256BE and HashToFieldSHA256BE consume this as a
+// big-endian (network) byte-ordered bitstream, matching how Solidity lays
+// the same inputs out so the contract doesn't have to re-order them.
+// HashToFieldPoseidon instead folds the field elements directly, skipping
+// the bit decomposition entirely.
+func computeInsertionInputHash(api frontend.API, strategy HashToField, startIndex, preRoot, postRoot frontend.Variable, idComms []frontend.Variable) (frontend.Variable, error) {
+	elements := append([]frontend.Variable{startIndex, preRoot, postRoot}, idComms...)
 
 	var bits []frontend.Variable
-	var err error
-
-	// We convert all the inputs to the keccak hash to use big-endian (network) byte
-	// ordering so that it agrees with Solidity. This ensures that we don't have to
-	// perform the conversion inside the contract and hence save on gas.
-	bits, err = ToBinaryBigEndian(circuit.StartIndex, 32, api)
-	if err != nil {
-		return err
-	}
-	kh.Write(bits...)
 
-	bits, err = ToBinaryBigEndian(circuit.PreRoot, 256, api)
-	if err != nil {
-		return err
-	}
-	kh.Write(bits...)
+	if strategy != HashToFieldPoseidon {
+		startIndexBits, err := ToBinaryBigEndian(startIndex, 32, api)
+		if err != nil {
+			return nil, err
+		}
+		bits = append(bits, startIndexBits...)
 
-	bits, err = ToBinaryBigEndian(circuit.PostRoot, 256, api)
-	if err != nil {
-		return err
-	}
-	kh.Write(bits...)
+		preRootBits, err := ToBinaryBigEndian(preRoot, 256, api)
+		if err != nil {
+			return nil, err
+		}
+		bits = append(bits, preRootBits...)
 
-	for i := 0; i < circuit.BatchSize; i++ {
-		bits, err = ToBinaryBigEndian(circuit.IdComms[i], 256, api)
+		postRootBits, err := ToBinaryBigEndian(postRoot, 256, api)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		bits = append(bits, postRootBits...)
+
+		for _, idComm := range idComms {
+			idCommBits, err := ToBinaryBigEndian(idComm, 256, api)
+			if err != nil {
+				return nil, err
+			}
+			bits = append(bits, idCommBits...)
 		}
-		kh.Write(bits...)
 	}
 
-	var sum frontend.Variable
-	sum, err = FromBinaryBigEndian(kh.Sum(), api)
+	return hashToFieldSum(api, strategy, bits, elements)
+}
+
+func (circuit *MbuCircuit) Define(api frontend.API) error {
+	sum, err := computeInsertionInputHash(api, circuit.HashToField, circuit.StartIndex, circuit.PreRoot, circuit.PostRoot, circuit.IdComms)
 	if err != nil {
 		return err
 	}
 
-	// The same endianness conversion has been performed in the hash generation
+	// The same conversion has been performed in the hash generation
 	// externally, so we can safely assert their equality here.
 	api.AssertIsEqual(circuit.InputHash, sum)
 
+	var hasher merkleHasher = r1csMerkleHasher{}
+	var gkrHasher *gkrMerkleHasher
+	if circuit.UseGKR {
+		gkrHasher = newGKRMerkleHasher(api)
+		hasher = gkrHasher
+	}
+
 	// Actual batch merkle proof verification.
 	root := abstractor.CallGadget(api, InsertionProof{
 		StartIndex: circuit.StartIndex,
@@ -214,8 +248,16 @@ func (circuit *MbuCircuit) Define(api frontend.API) error {
 
 		BatchSize: circuit.BatchSize,
 		Depth: circuit.Depth,
+
+		Hasher: hasher,
 	})[0]
 
+	if gkrHasher != nil {
+		if err := gkrHasher.Finalize(); err != nil {
+			return err
+		}
+	}
+
 	// Final root needs to match.
 	api.AssertIsEqual(root, circuit.PostRoot)
 
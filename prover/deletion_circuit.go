@@ -0,0 +1,158 @@
+package prover
+
+import (
+	"github.com/consensys/gnark/frontend"
+	"github.com/reilabs/gnark-lean-extractor/abstractor"
+)
+
+// noopLeaf is the sentinel identity commitment used to pad a deletion batch
+// when there are fewer deletions than BatchSize. A slot whose IdComm is
+// noopLeaf is verified against itself and leaves the root untouched.
+const noopLeaf = 0
+
+type DeletionMbuCircuit struct {
+	// single public input
+	InputHash frontend.Variable `gnark:",public"`
+
+	// private inputs, but used as public inputs
+	DeletionIndices []frontend.Variable `gnark:"input"`
+	PreRoot         frontend.Variable   `gnark:"input"`
+	PostRoot        frontend.Variable   `gnark:"input"`
+	IdComms         []frontend.Variable `gnark:"input"`
+
+	// private inputs
+	MerkleProofs [][]frontend.Variable `gnark:"input"`
+
+	BatchSize int
+	Depth     int
+
+	// UseGKR routes the batch's Poseidon2 evaluations through a GKR sumcheck
+	// instance instead of proving each one as its own set of R1CS
+	// constraints. Off by default; InputHash is identical either way.
+	UseGKR bool
+
+	// HashToField selects how InputHash is derived from the fields above.
+	// Zero value is HashToFieldKeccak256BE, matching historical behaviour.
+	HashToField HashToField
+}
+
+type DeletionProof struct {
+	DeletionIndices []frontend.Variable
+	PreRoot         frontend.Variable
+	IdComms         []frontend.Variable
+
+	MerkleProofs [][]frontend.Variable
+
+	BatchSize int
+	Depth     int
+
+	Hasher merkleHasher
+}
+
+func (gadget DeletionProof) DefineGadget(api abstractor.API) []frontend.Variable {
+	prevRoot := gadget.PreRoot
+
+	for i := 0; i < gadget.BatchSize; i += 1 {
+		currentPath := api.ToBinary(gadget.DeletionIndices[i], gadget.Depth)
+
+		// A batch that is not full is padded with noop slots: skip the
+		// membership check and leave the root as-is for those slots.
+		skip := api.IsZero(api.Sub(gadget.IdComms[i], noopLeaf))
+
+		// Verify proof for the identity commitment being deleted.
+		proof := append([]frontend.Variable{gadget.IdComms[i]}, gadget.MerkleProofs[i][:]...)
+		root := api.Call(VerifyProof{Proof: proof, Path: currentPath, Hasher: gadget.Hasher})[0]
+		root = api.Select(skip, prevRoot, root)
+		api.AssertIsEqual(root, prevRoot)
+
+		// Verify proof for the now-empty leaf and use it as the new root.
+		proof = append([]frontend.Variable{emptyLeaf}, gadget.MerkleProofs[i][:]...)
+		root = api.Call(VerifyProof{Proof: proof, Path: currentPath, Hasher: gadget.Hasher})[0]
+
+		prevRoot = api.Select(skip, prevRoot, root)
+	}
+
+	return []frontend.Variable{prevRoot}
+}
+
+// computeDeletionInputHash computes the InputHash DeletionMbuCircuit checks,
+// from the same fields, under strategy. AggregationCircuit calls this too,
+// so that it can rederive InputHash_i in-circuit instead of trusting a
+// caller-supplied copy that was never tied to PreRoots[i]/PostRoots[i].
+//
+// Inputs are arranged as follows:
+// DeletionIndices[0] || ... || DeletionIndices[batchSize-1] || PreRoot || PostRoot
+//          32        || ... ||           32                ||   256   ||   256
+//
+// See computeInsertionInputHash for why this layout only matters for the
+// byte-oriented HashToField strategies.
+func computeDeletionInputHash(api frontend.API, strategy HashToField, deletionIndices []frontend.Variable, preRoot, postRoot frontend.Variable) (frontend.Variable, error) {
+	elements := make([]frontend.Variable, 0, len(deletionIndices)+2)
+	elements = append(elements, deletionIndices...)
+	elements = append(elements, preRoot, postRoot)
+
+	var bits []frontend.Variable
+
+	if strategy != HashToFieldPoseidon {
+		for _, deletionIndex := range deletionIndices {
+			indexBits, err := ToBinaryBigEndian(deletionIndex, 32, api)
+			if err != nil {
+				return nil, err
+			}
+			bits = append(bits, indexBits...)
+		}
+
+		preRootBits, err := ToBinaryBigEndian(preRoot, 256, api)
+		if err != nil {
+			return nil, err
+		}
+		bits = append(bits, preRootBits...)
+
+		postRootBits, err := ToBinaryBigEndian(postRoot, 256, api)
+		if err != nil {
+			return nil, err
+		}
+		bits = append(bits, postRootBits...)
+	}
+
+	return hashToFieldSum(api, strategy, bits, elements)
+}
+
+func (circuit *DeletionMbuCircuit) Define(api frontend.API) error {
+	sum, err := computeDeletionInputHash(api, circuit.HashToField, circuit.DeletionIndices, circuit.PreRoot, circuit.PostRoot)
+	if err != nil {
+		return err
+	}
+
+	api.AssertIsEqual(circuit.InputHash, sum)
+
+	var hasher merkleHasher = r1csMerkleHasher{}
+	var gkrHasher *gkrMerkleHasher
+	if circuit.UseGKR {
+		gkrHasher = newGKRMerkleHasher(api)
+		hasher = gkrHasher
+	}
+
+	root := abstractor.CallGadget(api, DeletionProof{
+		DeletionIndices: circuit.DeletionIndices,
+		PreRoot:         circuit.PreRoot,
+		IdComms:         circuit.IdComms,
+
+		MerkleProofs: circuit.MerkleProofs,
+
+		BatchSize: circuit.BatchSize,
+		Depth:     circuit.Depth,
+
+		Hasher: hasher,
+	})[0]
+
+	if gkrHasher != nil {
+		if err := gkrHasher.Finalize(); err != nil {
+			return err
+		}
+	}
+
+	api.AssertIsEqual(root, circuit.PostRoot)
+
+	return nil
+}
@@ -7,12 +7,18 @@ import (
 	"math/big"
 	"worldcoin/gnark-mbu/logging"
 
+	"crypto/sha256"
+
 	"github.com/consensys/gnark-crypto/ecc"
 	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/plonk"
 	"github.com/consensys/gnark/constraint"
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/frontend/cs/scs"
 	"github.com/iden3/go-iden3-crypto/keccak256"
+
+	"worldcoin/gnark-mbu/prover/poseidon"
 )
 
 type DeletionParameters struct {
@@ -42,52 +48,119 @@ func (p *DeletionParameters) ValidateShape(treeDepth uint32, batchSize uint32) e
 	return nil
 }
 
-// ComputeInputHashDeletion computes the input hash to the prover and verifier.
+// ComputeInputHashDeletion computes the input hash to the prover and
+// verifier, using whichever strategy hashToField selects. This must produce
+// exactly the value DeletionMbuCircuit.Define derives from the same fields
+// via hashToFieldSum, or the prover's AssertIsEqual against InputHash fails.
 //
-// It uses big-endian byte ordering (network ordering) in order to agree with
-// Solidity and avoid the need to perform the byte swapping operations on-chain
-// where they would increase our gas cost.
-func (p *DeletionParameters) ComputeInputHashDeletion() error {
+// HashToFieldKeccak256BE and HashToFieldSHA256BE use big-endian byte ordering
+// (network ordering) in order to agree with Solidity and avoid the need to
+// perform the byte swapping operations on-chain where they would increase
+// our gas cost. HashToFieldPoseidon instead folds the field elements
+// directly, matching PoseidonFold.
+func (p *DeletionParameters) ComputeInputHashDeletion(hashToField HashToField) error {
+	switch hashToField {
+	case HashToFieldKeccak256BE:
+		data, err := p.inputHashBytesBE()
+		if err != nil {
+			return err
+		}
+		p.InputHash.SetBytes(keccak256.Hash(data))
+		return nil
+	case HashToFieldSHA256BE:
+		data, err := p.inputHashBytesBE()
+		if err != nil {
+			return err
+		}
+		digest := sha256.Sum256(data)
+		p.InputHash.SetBytes(digest[:])
+		return nil
+	case HashToFieldPoseidon:
+		acc := big.NewInt(int64(p.DeletionIndices[0]))
+		for _, index := range p.DeletionIndices[1:] {
+			acc = poseidon.Hash(acc, big.NewInt(int64(index)))
+		}
+		acc = poseidon.Hash(acc, &p.PreRoot)
+		acc = poseidon.Hash(acc, &p.PostRoot)
+		p.InputHash.Set(acc)
+		return nil
+	default:
+		return fmt.Errorf("unknown hash-to-field strategy: %d", hashToField)
+	}
+}
+
+// inputHashBytesBE lays out the fields ComputeInputHashDeletion hashes as a
+// big-endian byte stream, matching the bit ordering DeletionMbuCircuit.Define
+// builds via ToBinaryBigEndian for the byte-oriented HashToField strategies.
+func (p *DeletionParameters) inputHashBytesBE() ([]byte, error) {
 	var data []byte
 	buf := new(bytes.Buffer)
 	err := binary.Write(buf, binary.BigEndian, p.DeletionIndices)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	data = append(data, buf.Bytes()...)
 	data = append(data, p.PreRoot.Bytes()...)
 	data = append(data, p.PostRoot.Bytes()...)
-
-	hashBytes := keccak256.Hash(data)
-	p.InputHash.SetBytes(hashBytes)
-	return nil
+	return data, nil
 }
 
-func BuildR1CSDeletion(treeDepth uint32, batchSize uint32) (constraint.ConstraintSystem, error) {
+func newDeletionCircuit(treeDepth uint32, batchSize uint32, useGKR bool, hashToField HashToField) *DeletionMbuCircuit {
 	proofs := make([][]frontend.Variable, batchSize)
 	for i := 0; i < int(batchSize); i++ {
 		proofs[i] = make([]frontend.Variable, treeDepth)
 	}
-	circuit := DeletionMbuCircuit{
+	return &DeletionMbuCircuit{
 		Depth:           int(treeDepth),
 		BatchSize:       int(batchSize),
 		DeletionIndices: make([]frontend.Variable, batchSize),
 		IdComms:         make([]frontend.Variable, batchSize),
 		MerkleProofs:    proofs,
+		UseGKR:          useGKR,
+		HashToField:     hashToField,
 	}
-	return frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &circuit)
 }
 
-func SetupDeletion(treeDepth uint32, batchSize uint32) (*ProvingSystem, error) {
-	ccs, err := BuildR1CSDeletion(treeDepth, batchSize)
-	if err != nil {
-		return nil, err
-	}
-	pk, vk, err := groth16.Setup(ccs)
-	if err != nil {
-		return nil, err
+func BuildR1CSDeletion(treeDepth uint32, batchSize uint32) (constraint.ConstraintSystem, error) {
+	return frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, newDeletionCircuit(treeDepth, batchSize, false, HashToFieldKeccak256BE))
+}
+
+// BuildSCSDeletion compiles the deletion circuit into the sparse constraint
+// system PLONK proves over, as opposed to the R1CS Groth16 uses.
+func BuildSCSDeletion(treeDepth uint32, batchSize uint32) (constraint.ConstraintSystem, error) {
+	return frontend.Compile(ecc.BN254.ScalarField(), scs.NewBuilder, newDeletionCircuit(treeDepth, batchSize, false, HashToFieldKeccak256BE))
+}
+
+func SetupDeletion(treeDepth uint32, batchSize uint32, backend Backend, useGKR bool, hashToField HashToField, srsPath string) (*ProvingSystem, error) {
+	const kind = BatchKindDeletion
+	switch backend {
+	case BackendGroth16:
+		ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, newDeletionCircuit(treeDepth, batchSize, useGKR, hashToField))
+		if err != nil {
+			return nil, err
+		}
+		pk, vk, err := groth16.Setup(ccs)
+		if err != nil {
+			return nil, err
+		}
+		return &ProvingSystem{treeDepth, batchSize, BackendGroth16, pk, vk, nil, ccs, useGKR, hashToField, kind}, nil
+	case BackendPLONK:
+		ccs, err := frontend.Compile(ecc.BN254.ScalarField(), scs.NewBuilder, newDeletionCircuit(treeDepth, batchSize, useGKR, hashToField))
+		if err != nil {
+			return nil, err
+		}
+		srs, srsLagrange, err := universalSRS(treeDepth, batchSize, ecc.BN254, srsPath, ccs)
+		if err != nil {
+			return nil, err
+		}
+		pk, vk, err := plonk.Setup(ccs, srs, srsLagrange)
+		if err != nil {
+			return nil, err
+		}
+		return &ProvingSystem{treeDepth, batchSize, BackendPLONK, nil, nil, &plonkKeys{pk, vk}, ccs, useGKR, hashToField, kind}, nil
+	default:
+		return nil, fmt.Errorf("unknown backend: %d", backend)
 	}
-	return &ProvingSystem{treeDepth, batchSize, pk, vk, ccs}, nil
 }
 
 func (ps *ProvingSystem) ProveDeletion(params *DeletionParameters) (*Proof, error) {
@@ -118,28 +191,32 @@ func (ps *ProvingSystem) ProveDeletion(params *DeletionParameters) (*Proof, erro
 		PostRoot:        params.PostRoot,
 		IdComms:         idComms,
 		MerkleProofs:    proofs,
+		UseGKR:          ps.UseGKR,
+		HashToField:     ps.HashToField,
 	}
 	witness, err := frontend.NewWitness(&assignment, ecc.BN254.ScalarField())
 	if err != nil {
 		return nil, err
 	}
 	logging.Logger().Info().Msg("generating proof")
-	proof, err := groth16.Prove(ps.ConstraintSystem, ps.ProvingKey, witness)
+	proof, err := ps.prove(witness)
 	if err != nil {
 		return nil, err
 	}
 	logging.Logger().Info().Msg("proof generated successfully")
-	return &Proof{proof}, nil
+	return proof, nil
 }
 
 func (ps *ProvingSystem) VerifyDeletion(inputHash big.Int, proof *Proof) error {
 	publicAssignment := DeletionMbuCircuit{
 		InputHash:       inputHash,
 		DeletionIndices: make([]frontend.Variable, ps.BatchSize),
+		UseGKR:          ps.UseGKR,
+		HashToField:     ps.HashToField,
 	}
 	witness, err := frontend.NewWitness(&publicAssignment, ecc.BN254.ScalarField(), frontend.PublicOnly())
 	if err != nil {
 		return err
 	}
-	return groth16.Verify(proof.Proof, ps.VerifyingKey, witness)
+	return ps.verify(proof, witness)
 }
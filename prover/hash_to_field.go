@@ -0,0 +1,86 @@
+package prover
+
+import (
+	"fmt"
+	"worldcoin/gnark-mbu/prover/keccak"
+	"worldcoin/gnark-mbu/prover/poseidon"
+	"worldcoin/gnark-mbu/prover/sha256"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/reilabs/gnark-lean-extractor/abstractor"
+)
+
+// HashToField selects how a batch's public inputs are folded down into the
+// single field element exposed as InputHash. Keccak256BE is the historical
+// default and matches what Solidity verifiers already deployed expect;
+// SHA256BE and Poseidon are cheaper to verify on chains where keccak isn't a
+// precompile.
+type HashToField uint8
+
+const (
+	HashToFieldKeccak256BE HashToField = iota
+	HashToFieldSHA256BE
+	HashToFieldPoseidon
+)
+
+func (h HashToField) String() string {
+	switch h {
+	case HashToFieldKeccak256BE:
+		return "keccak256be"
+	case HashToFieldSHA256BE:
+		return "sha256be"
+	case HashToFieldPoseidon:
+		return "poseidon"
+	default:
+		return "unknown"
+	}
+}
+
+// PoseidonFold hashes elements down to a single field element by chaining
+// Poseidon2, avoiding the big-endian bit-packing the byte-oriented hashes
+// need. It has no bearing on the tree's own Poseidon2 hashing (see
+// ProofRound); it derives InputHash, and AggregationCircuit's
+// InputHashesCommitment.
+type PoseidonFold struct {
+	Elements []frontend.Variable
+}
+
+func (gadget PoseidonFold) DefineGadget(api abstractor.API) []frontend.Variable {
+	acc := gadget.Elements[0]
+	for _, elem := range gadget.Elements[1:] {
+		acc = api.Call(poseidon.Poseidon2{In1: acc, In2: elem})[0]
+	}
+	return []frontend.Variable{acc}
+}
+
+// hashToFieldSum computes InputHash under the given strategy. bits is the
+// big-endian bit-packed message the byte-oriented hashes consume; elements
+// is the same input laid out as field elements, which is all Poseidon needs.
+func hashToFieldSum(api frontend.API, strategy HashToField, bits []frontend.Variable, elements []frontend.Variable) (frontend.Variable, error) {
+	switch strategy {
+	case HashToFieldKeccak256BE:
+		kh := keccak.NewKeccak256(api, len(bits))
+		kh.Write(bits...)
+		return FromBinaryBigEndian(kh.Sum(), api)
+	case HashToFieldSHA256BE:
+		// The sha256 gadget numbers bits MSB-first within each byte, while
+		// ToBinaryBigEndian/FromBinaryBigEndian keep them LSB-first.
+		sh := sha256.NewSha256(api, len(bits))
+		sh.Write(reverseBitsInBytes(bits)...)
+		return FromBinaryBigEndian(reverseBitsInBytes(sh.Sum()), api)
+	case HashToFieldPoseidon:
+		return abstractor.CallGadget(api, PoseidonFold{Elements: elements})[0], nil
+	default:
+		return nil, fmt.Errorf("unknown hash-to-field strategy: %d", strategy)
+	}
+}
+
+// reverseBitsInBytes reverses the bit order inside each 8-bit group of bits,
+// leaving the order of the groups unchanged. len(bits) must be a multiple of 8.
+func reverseBitsInBytes(bits []frontend.Variable) []frontend.Variable {
+	out := make([]frontend.Variable, len(bits))
+	for i := range bits {
+		out[i] = bits[i-i%8+7-i%8]
+	}
+	return out
+}
@@ -0,0 +1,57 @@
+package prover
+
+import (
+	"math/big"
+	"testing"
+)
+
+// TestComputeInputHashInsertionRespectsStrategy exercises every
+// HashToField strategy end to end. Before ComputeInputHashInsertion took a
+// HashToField parameter, it always hashed with keccak256 regardless of what
+// the circuit was compiled with, so SetupInsertion(..., HashToFieldSHA256BE)
+// or HashToFieldPoseidon would always fail the in-circuit AssertIsEqual
+// against InputHash.
+func TestComputeInputHashInsertionRespectsStrategy(t *testing.T) {
+	const depth = 2
+	const batchSize = 1
+
+	for _, strategy := range []HashToField{HashToFieldKeccak256BE, HashToFieldSHA256BE, HashToFieldPoseidon} {
+		strategy := strategy
+		t.Run(strategy.String(), func(t *testing.T) {
+			ps, err := SetupInsertion(depth, batchSize, BackendGroth16, false, strategy, "")
+			if err != nil {
+				t.Fatalf("SetupInsertion: %v", err)
+			}
+			if ps.HashToField != strategy {
+				t.Fatalf("ProvingSystem.HashToField = %v, want %v", ps.HashToField, strategy)
+			}
+
+			params := &InsertionParameters{
+				StartIndex:   0,
+				PreRoot:      *big.NewInt(11),
+				PostRoot:     *big.NewInt(22),
+				IdComms:      []big.Int{*big.NewInt(1)},
+				MerkleProofs: [][]big.Int{{*big.NewInt(0)}},
+			}
+			if err := params.ComputeInputHashInsertion(strategy); err != nil {
+				t.Fatalf("ComputeInputHashInsertion: %v", err)
+			}
+
+			// A wrong InputHash under this strategy would fail the circuit's
+			// AssertIsEqual, but a Merkle proof mismatch would too; isolate
+			// the hash-to-field bug by recomputing under a different
+			// strategy and checking it disagrees.
+			other := HashToFieldKeccak256BE
+			if strategy == HashToFieldKeccak256BE {
+				other = HashToFieldSHA256BE
+			}
+			otherParams := *params
+			if err := otherParams.ComputeInputHashInsertion(other); err != nil {
+				t.Fatalf("ComputeInputHashInsertion (other): %v", err)
+			}
+			if params.InputHash.Cmp(&otherParams.InputHash) == 0 {
+				t.Fatalf("InputHash did not vary with HashToField strategy")
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package prover
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"worldcoin/gnark-mbu/logging"
+
+	"crypto/sha256"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/frontend/cs/scs"
+	"github.com/iden3/go-iden3-crypto/keccak256"
+
+	"worldcoin/gnark-mbu/prover/poseidon"
+)
+
+type InsertionParameters struct {
+	InputHash    big.Int
+	StartIndex   uint32
+	PreRoot      big.Int
+	PostRoot     big.Int
+	IdComms      []big.Int
+	MerkleProofs [][]big.Int
+}
+
+func (p *InsertionParameters) ValidateShape(treeDepth uint32, batchSize uint32) error {
+	if len(p.IdComms) != int(batchSize) {
+		return fmt.Errorf("wrong number of identity commitments: %d", len(p.IdComms))
+	}
+	if len(p.MerkleProofs) != int(batchSize) {
+		return fmt.Errorf("wrong number of merkle proofs: %d", len(p.MerkleProofs))
+	}
+	for i, proof := range p.MerkleProofs {
+		if len(proof) != int(treeDepth) {
+			return fmt.Errorf("wrong size of merkle proof for proof %d: %d", i, len(proof))
+		}
+	}
+	return nil
+}
+
+// ComputeInputHashInsertion computes the input hash to the prover and
+// verifier, using whichever strategy hashToField selects. This must produce
+// exactly the value MbuCircuit.Define derives from the same fields via
+// hashToFieldSum, or the prover's AssertIsEqual against InputHash fails.
+//
+// HashToFieldKeccak256BE and HashToFieldSHA256BE use big-endian byte ordering
+// (network ordering) in order to agree with Solidity and avoid the need to
+// perform the byte swapping operations on-chain where they would increase
+// our gas cost. HashToFieldPoseidon instead folds the field elements
+// directly, matching PoseidonFold.
+func (p *InsertionParameters) ComputeInputHashInsertion(hashToField HashToField) error {
+	switch hashToField {
+	case HashToFieldKeccak256BE:
+		data, err := p.inputHashBytesBE()
+		if err != nil {
+			return err
+		}
+		p.InputHash.SetBytes(keccak256.Hash(data))
+		return nil
+	case HashToFieldSHA256BE:
+		data, err := p.inputHashBytesBE()
+		if err != nil {
+			return err
+		}
+		digest := sha256.Sum256(data)
+		p.InputHash.SetBytes(digest[:])
+		return nil
+	case HashToFieldPoseidon:
+		acc := big.NewInt(int64(p.StartIndex))
+		acc = poseidon.Hash(acc, &p.PreRoot)
+		acc = poseidon.Hash(acc, &p.PostRoot)
+		for _, idComm := range p.IdComms {
+			acc = poseidon.Hash(acc, &idComm)
+		}
+		p.InputHash.Set(acc)
+		return nil
+	default:
+		return fmt.Errorf("unknown hash-to-field strategy: %d", hashToField)
+	}
+}
+
+// inputHashBytesBE lays out the fields ComputeInputHashInsertion hashes as a
+// big-endian byte stream, matching the bit ordering MbuCircuit.Define builds
+// via ToBinaryBigEndian for the byte-oriented HashToField strategies.
+func (p *InsertionParameters) inputHashBytesBE() ([]byte, error) {
+	var data []byte
+	buf := new(bytes.Buffer)
+	err := binary.Write(buf, binary.BigEndian, p.StartIndex)
+	if err != nil {
+		return nil, err
+	}
+	data = append(data, buf.Bytes()...)
+	// Every field element takes a full 32 bytes, just as the circuit
+	// decomposes it into 256 bits whatever its magnitude.
+	var field [32]byte
+	data = append(data, p.PreRoot.FillBytes(field[:])...)
+	data = append(data, p.PostRoot.FillBytes(field[:])...)
+	for _, idComm := range p.IdComms {
+		data = append(data, idComm.FillBytes(field[:])...)
+	}
+	return data, nil
+}
+
+func newInsertionCircuit(treeDepth uint32, batchSize uint32, useGKR bool, hashToField HashToField) *MbuCircuit {
+	proofs := make([][]frontend.Variable, batchSize)
+	for i := 0; i < int(batchSize); i++ {
+		proofs[i] = make([]frontend.Variable, treeDepth)
+	}
+	return &MbuCircuit{
+		Depth:        int(treeDepth),
+		BatchSize:    int(batchSize),
+		IdComms:      make([]frontend.Variable, batchSize),
+		MerkleProofs: proofs,
+		UseGKR:       useGKR,
+		HashToField:  hashToField,
+	}
+}
+
+func BuildR1CSInsertion(treeDepth uint32, batchSize uint32) (constraint.ConstraintSystem, error) {
+	return frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, newInsertionCircuit(treeDepth, batchSize, false, HashToFieldKeccak256BE))
+}
+
+// BuildSCSInsertion compiles the insertion circuit into the sparse constraint
+// system PLONK proves over, as opposed to the R1CS Groth16 uses.
+func BuildSCSInsertion(treeDepth uint32, batchSize uint32) (constraint.ConstraintSystem, error) {
+	return frontend.Compile(ecc.BN254.ScalarField(), scs.NewBuilder, newInsertionCircuit(treeDepth, batchSize, false, HashToFieldKeccak256BE))
+}
+
+func SetupInsertion(treeDepth uint32, batchSize uint32, backend Backend, useGKR bool, hashToField HashToField, srsPath string) (*ProvingSystem, error) {
+	const kind = BatchKindInsertion
+	switch backend {
+	case BackendGroth16:
+		ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, newInsertionCircuit(treeDepth, batchSize, useGKR, hashToField))
+		if err != nil {
+			return nil, err
+		}
+		pk, vk, err := groth16.Setup(ccs)
+		if err != nil {
+			return nil, err
+		}
+		return &ProvingSystem{treeDepth, batchSize, BackendGroth16, pk, vk, nil, ccs, useGKR, hashToField, kind}, nil
+	case BackendPLONK:
+		ccs, err := frontend.Compile(ecc.BN254.ScalarField(), scs.NewBuilder, newInsertionCircuit(treeDepth, batchSize, useGKR, hashToField))
+		if err != nil {
+			return nil, err
+		}
+		srs, srsLagrange, err := universalSRS(treeDepth, batchSize, ecc.BN254, srsPath, ccs)
+		if err != nil {
+			return nil, err
+		}
+		pk, vk, err := plonk.Setup(ccs, srs, srsLagrange)
+		if err != nil {
+			return nil, err
+		}
+		return &ProvingSystem{treeDepth, batchSize, BackendPLONK, nil, nil, &plonkKeys{pk, vk}, ccs, useGKR, hashToField, kind}, nil
+	default:
+		return nil, fmt.Errorf("unknown backend: %d", backend)
+	}
+}
+
+func (ps *ProvingSystem) ProveInsertion(params *InsertionParameters) (*Proof, error) {
+	if err := params.ValidateShape(ps.TreeDepth, ps.BatchSize); err != nil {
+		return nil, err
+	}
+
+	idComms := make([]frontend.Variable, ps.BatchSize)
+	for i := 0; i < int(ps.BatchSize); i++ {
+		idComms[i] = params.IdComms[i]
+	}
+	proofs := make([][]frontend.Variable, ps.BatchSize)
+	for i := 0; i < int(ps.BatchSize); i++ {
+		proofs[i] = make([]frontend.Variable, ps.TreeDepth)
+		for j := 0; j < int(ps.TreeDepth); j++ {
+			proofs[i][j] = params.MerkleProofs[i][j]
+		}
+	}
+	assignment := MbuCircuit{
+		InputHash:    params.InputHash,
+		StartIndex:   params.StartIndex,
+		PreRoot:      params.PreRoot,
+		PostRoot:     params.PostRoot,
+		IdComms:      idComms,
+		MerkleProofs: proofs,
+		UseGKR:       ps.UseGKR,
+		HashToField:  ps.HashToField,
+	}
+	witness, err := frontend.NewWitness(&assignment, ecc.BN254.ScalarField())
+	if err != nil {
+		return nil, err
+	}
+
+	logging.Logger().Info().Msg("generating proof")
+	proof, err := ps.prove(witness)
+	if err != nil {
+		return nil, err
+	}
+	logging.Logger().Info().Msg("proof generated successfully")
+	return proof, nil
+}
+
+func (ps *ProvingSystem) VerifyInsertion(inputHash big.Int, proof *Proof) error {
+	publicAssignment := MbuCircuit{
+		InputHash:   inputHash,
+		UseGKR:      ps.UseGKR,
+		HashToField: ps.HashToField,
+	}
+	witness, err := frontend.NewWitness(&publicAssignment, ecc.BN254.ScalarField(), frontend.PublicOnly())
+	if err != nil {
+		return err
+	}
+	return ps.verify(proof, witness)
+}
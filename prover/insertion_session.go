@@ -0,0 +1,121 @@
+package prover
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+
+	"worldcoin/gnark-mbu/prover/poseidon"
+)
+
+// InsertionSession accumulates identities for a single insertion batch as
+// they arrive, rather than all at once right before proving. Batches
+// typically close on a wall-clock deadline rather than once BatchSize
+// identities are ready, so AddIdentity does the per-slot work — validating
+// the caller's Merkle proof and folding it into the running root — as soon
+// as an identity is added. Prove then only has to marshal what's already
+// been computed and hand it to groth16.Prove/plonk.Prove, bounding the
+// latency at batch-close instead of paying for the whole batch's Merkle
+// walk there.
+type InsertionSession struct {
+	ps *ProvingSystem
+
+	mu           sync.Mutex
+	startIndex   uint32
+	preRoot      big.Int
+	currentRoot  big.Int
+	idComms      []big.Int
+	merkleProofs [][]big.Int
+}
+
+// NewInsertionSession starts a new insertion batch rooted at preRoot.
+// Identities are assigned indices sequentially starting at 0.
+func (ps *ProvingSystem) NewInsertionSession(preRoot big.Int) *InsertionSession {
+	session := &InsertionSession{ps: ps}
+	session.preRoot.Set(&preRoot)
+	session.currentRoot.Set(&preRoot)
+	return session
+}
+
+// AddIdentity appends idComm at the next free slot in the batch, verifying
+// merkleProof against the empty leaf at the session's current root and
+// folding the resulting insertion into currentRoot. It returns an error if
+// the session is already full or if merkleProof doesn't verify.
+func (s *InsertionSession) AddIdentity(idComm big.Int, merkleProof []big.Int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if uint32(len(s.idComms)) >= s.ps.BatchSize {
+		return fmt.Errorf("session is full: batch size is %d", s.ps.BatchSize)
+	}
+	if len(merkleProof) != int(s.ps.TreeDepth) {
+		return fmt.Errorf("wrong size of merkle proof: %d", len(merkleProof))
+	}
+
+	index := s.startIndex + uint32(len(s.idComms))
+	path := indexToPath(index, s.ps.TreeDepth)
+
+	emptyRoot := foldMerkleProof(new(big.Int), merkleProof, path)
+	if emptyRoot.Cmp(&s.currentRoot) != 0 {
+		return fmt.Errorf("merkle proof for slot %d does not match the current root", index)
+	}
+
+	newRoot := foldMerkleProof(&idComm, merkleProof, path)
+
+	s.idComms = append(s.idComms, idComm)
+	s.merkleProofs = append(s.merkleProofs, merkleProof)
+	s.currentRoot.Set(newRoot)
+	return nil
+}
+
+// Prove produces the batch proof for the identities added. It returns an
+// error unless exactly BatchSize identities have been added, since
+// ProveInsertion rejects a batch of any other size. The session must not be
+// reused afterwards.
+func (s *InsertionSession) Prove() (*Proof, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	params := &InsertionParameters{
+		StartIndex:   s.startIndex,
+		PreRoot:      s.preRoot,
+		PostRoot:     s.currentRoot,
+		IdComms:      s.idComms,
+		MerkleProofs: s.merkleProofs,
+	}
+	if err := params.ComputeInputHashInsertion(s.ps.HashToField); err != nil {
+		return nil, err
+	}
+	return s.ps.ProveInsertion(params)
+}
+
+// indexToPath mirrors the bit decomposition InsertionProof.DefineGadget gets
+// from api.ToBinary(currentIndex, depth), so AddIdentity walks merkleProof
+// the same way the circuit does. api.ToBinary is LSB-first: path[0] is the
+// bit that picks the direction at the leaf's own level, path[depth-1] the
+// one nearest the root.
+func indexToPath(index uint32, depth uint32) []bool {
+	path := make([]bool, depth)
+	for i := uint32(0); i < depth; i++ {
+		path[i] = (index>>i)&1 == 1
+	}
+	return path
+}
+
+// foldMerkleProof recomputes the root obtained by walking leaf up through
+// proof, taking a left/right turn at each level according to path. It uses
+// the same Poseidon2 compression the circuit's ProofRound gadget proves, and
+// the same operand order: ProofRound puts the running hash on the side
+// picked by a 0 direction bit and the sibling on the side picked by a 1, so
+// a set bit means the sibling comes first.
+func foldMerkleProof(leaf *big.Int, proof []big.Int, path []bool) *big.Int {
+	acc := new(big.Int).Set(leaf)
+	for i, sibling := range proof {
+		if path[i] {
+			acc = poseidon.Hash(&sibling, acc)
+		} else {
+			acc = poseidon.Hash(acc, &sibling)
+		}
+	}
+	return acc
+}
@@ -0,0 +1,75 @@
+package prover
+
+import (
+	"math/big"
+	"testing"
+
+	"worldcoin/gnark-mbu/prover/poseidon"
+)
+
+// TestIndexToPathMatchesToBinary pins indexToPath to api.ToBinary's LSB-first
+// convention. Before the fix, path[0] held the index's most significant bit
+// instead of its least significant one, so AddIdentity walked merkleProof in
+// the wrong order for any index that wasn't a binary palindrome.
+func TestIndexToPathMatchesToBinary(t *testing.T) {
+	got := indexToPath(1, 2) // index 0b01 at depth 2: LSB-first is [1, 0].
+	want := []bool{true, false}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("indexToPath(1, 2) = %v, want %v", got, want)
+	}
+}
+
+// TestInsertionSessionRoundTrip exercises AddIdentity for index 1 in a
+// depth-2 tree, where the old MSB-first bit order and the correct LSB-first
+// one disagree (path(1) is [0,1] MSB-first vs [1,0] LSB-first). Under the
+// bug, AddIdentity's own emptyRoot sanity check failed for this slot before
+// a proof was ever attempted; a fresh full round trip through Prove and
+// VerifyInsertion confirms both the bit order and foldMerkleProof's operand
+// order now agree with the circuit end to end.
+func TestInsertionSessionRoundTrip(t *testing.T) {
+	const depth = 2
+	const batchSize = 2
+
+	ps, err := SetupInsertion(depth, batchSize, BackendGroth16, false, HashToFieldKeccak256BE, "")
+	if err != nil {
+		t.Fatalf("SetupInsertion: %v", err)
+	}
+
+	// A fresh depth-2 tree, four empty leaves: every sibling at every level
+	// is the hash of an empty subtree.
+	sibling0 := poseidon.Hash(big.NewInt(0), big.NewInt(0))
+	preRoot := poseidon.Hash(sibling0, sibling0)
+
+	session := ps.NewInsertionSession(*preRoot)
+
+	// Slot for index 0: insert the empty leaf itself, a no-op that just
+	// advances the session onto index 1.
+	if err := session.AddIdentity(*big.NewInt(0), []big.Int{*big.NewInt(0), *sibling0}); err != nil {
+		t.Fatalf("AddIdentity(index 0): %v", err)
+	}
+
+	// Slot for index 1: the tree is still fully empty at this point, so by
+	// symmetry the merkle proof has the same values as index 0's, but a
+	// different direction at the leaf level.
+	if err := session.AddIdentity(*big.NewInt(1), []big.Int{*big.NewInt(0), *sibling0}); err != nil {
+		t.Fatalf("AddIdentity(index 1): %v", err)
+	}
+
+	proof, err := session.Prove()
+	if err != nil {
+		t.Fatalf("Prove: %v", err)
+	}
+	params := &InsertionParameters{
+		StartIndex:   session.startIndex,
+		PreRoot:      session.preRoot,
+		PostRoot:     session.currentRoot,
+		IdComms:      session.idComms,
+		MerkleProofs: session.merkleProofs,
+	}
+	if err := params.ComputeInputHashInsertion(HashToFieldKeccak256BE); err != nil {
+		t.Fatalf("ComputeInputHashInsertion: %v", err)
+	}
+	if err := ps.VerifyInsertion(params.InputHash, proof); err != nil {
+		t.Fatalf("VerifyInsertion: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package prover
+
+import (
+	"math/big"
+	"testing"
+
+	"worldcoin/gnark-mbu/prover/poseidon"
+)
+
+// TestGKRMerkleHasherRoundTrip exercises the UseGKR path end to end. Before
+// gkrMerkleHasher.Hash returned the real GKR wire, every hash under UseGKR
+// resolved to a fresh zero constant, so this would only ever have passed for
+// an all-zero tree; a fresh depth-2 tree with a real identity commitment
+// exercises the bug directly.
+func TestGKRMerkleHasherRoundTrip(t *testing.T) {
+	const depth = 2
+	const batchSize = 1
+
+	ps, err := SetupInsertion(depth, batchSize, BackendGroth16, true, HashToFieldKeccak256BE, "")
+	if err != nil {
+		t.Fatalf("SetupInsertion: %v", err)
+	}
+
+	emptySubtree := poseidon.Hash(big.NewInt(0), big.NewInt(0))
+	idComm := big.NewInt(1)
+
+	params := &InsertionParameters{
+		StartIndex:   0,
+		PreRoot:      *poseidon.Hash(emptySubtree, emptySubtree),
+		PostRoot:     *poseidon.Hash(poseidon.Hash(idComm, big.NewInt(0)), emptySubtree),
+		IdComms:      []big.Int{*idComm},
+		MerkleProofs: [][]big.Int{{*big.NewInt(0), *emptySubtree}},
+	}
+	if err := params.ComputeInputHashInsertion(HashToFieldKeccak256BE); err != nil {
+		t.Fatalf("ComputeInputHashInsertion: %v", err)
+	}
+
+	proof, err := ps.ProveInsertion(params)
+	if err != nil {
+		t.Fatalf("ProveInsertion: %v", err)
+	}
+	if err := ps.VerifyInsertion(params.InputHash, proof); err != nil {
+		t.Fatalf("VerifyInsertion: %v", err)
+	}
+}
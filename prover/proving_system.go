@@ -0,0 +1,109 @@
+package prover
+
+import (
+	"fmt"
+
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/constraint"
+)
+
+// Backend selects the proving system used to compile and prove a circuit.
+// Groth16 keeps the per-(depth,batchSize) trusted setup semantics the
+// prover has always had; PLONK trades that setup for a universal SRS
+// shared across parameter combinations, at the cost of a larger proof.
+type Backend uint8
+
+const (
+	BackendGroth16 Backend = iota
+	BackendPLONK
+)
+
+func (b Backend) String() string {
+	switch b {
+	case BackendGroth16:
+		return "groth16"
+	case BackendPLONK:
+		return "plonk"
+	default:
+		return "unknown"
+	}
+}
+
+// plonkKeys holds the PLONK proving/verifying key pair for a ProvingSystem.
+// It is nil for a Groth16-backed ProvingSystem.
+type plonkKeys struct {
+	ProvingKey   plonk.ProvingKey
+	VerifyingKey plonk.VerifyingKey
+}
+
+type ProvingSystem struct {
+	TreeDepth uint32
+	BatchSize uint32
+	Backend   Backend
+
+	// Populated when Backend == BackendGroth16.
+	ProvingKey   groth16.ProvingKey
+	VerifyingKey groth16.VerifyingKey
+
+	// Populated when Backend == BackendPLONK.
+	Plonk *plonkKeys
+
+	ConstraintSystem constraint.ConstraintSystem
+
+	// UseGKR mirrors the UseGKR flag the circuit was compiled with, so that
+	// ProveInsertion/ProveDeletion assign a witness of the matching shape.
+	UseGKR bool
+
+	// HashToField mirrors the HashToField strategy the circuit was compiled
+	// with, and is what ExportSolidityVerifier wires the emitted verifier to.
+	HashToField HashToField
+
+	// Kind records whether this proving system proves insertions or
+	// deletions, so ProveAggregate knows which InputHash formula to
+	// rederive for proofs it produced.
+	Kind BatchKind
+}
+
+// Proof wraps the backend-specific proof so that callers of ProveInsertion /
+// ProveDeletion don't need to know which backend produced it; VerifyInsertion
+// / VerifyDeletion dispatch on ps.Backend rather than on the shape of the proof.
+type Proof struct {
+	Backend      Backend
+	Groth16Proof groth16.Proof
+	PlonkProof   plonk.Proof
+}
+
+func (ps *ProvingSystem) prove(w witness.Witness) (*Proof, error) {
+	switch ps.Backend {
+	case BackendGroth16:
+		proof, err := groth16.Prove(ps.ConstraintSystem, ps.ProvingKey, w)
+		if err != nil {
+			return nil, err
+		}
+		return &Proof{Backend: BackendGroth16, Groth16Proof: proof}, nil
+	case BackendPLONK:
+		proof, err := plonk.Prove(ps.ConstraintSystem, ps.Plonk.ProvingKey, w)
+		if err != nil {
+			return nil, err
+		}
+		return &Proof{Backend: BackendPLONK, PlonkProof: proof}, nil
+	default:
+		return nil, fmt.Errorf("unknown backend: %d", ps.Backend)
+	}
+}
+
+func (ps *ProvingSystem) verify(proof *Proof, w witness.Witness) error {
+	if proof.Backend != ps.Backend {
+		return fmt.Errorf("proof backend %s does not match proving system backend %s", proof.Backend, ps.Backend)
+	}
+	switch ps.Backend {
+	case BackendGroth16:
+		return groth16.Verify(proof.Groth16Proof, ps.VerifyingKey, w)
+	case BackendPLONK:
+		return plonk.Verify(proof.PlonkProof, ps.Plonk.VerifyingKey, w)
+	default:
+		return fmt.Errorf("unknown backend: %d", ps.Backend)
+	}
+}
@@ -0,0 +1,245 @@
+// Package sha256 implements SHA-256 as an in-circuit gadget operating
+// directly on bit variables, mirroring the keccak package's
+// NewKeccak256/Write/Sum shape. Write consumes the message as SHA-256 reads
+// it, bytes in order and each byte's bits most significant first, and Sum
+// returns the digest in the same order.
+package sha256
+
+import (
+	"github.com/consensys/gnark/frontend"
+)
+
+// blockBits is the size of one SHA-256 message block.
+const blockBits = 512
+
+// wordBits is the size of one SHA-256 word (and of each digest/schedule
+// entry below): a [32]frontend.Variable with index 0 the most significant
+// bit. This differs from ToBinaryBigEndian/FromBinaryBigEndian in the prover
+// package, which keep bits least significant first within each byte.
+const wordBits = 32
+
+type word = [wordBits]frontend.Variable
+
+// iv is SHA-256's initial hash value, the fractional parts of the square
+// roots of the first 8 primes.
+var iv = [8]uint32{
+	0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a,
+	0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19,
+}
+
+// roundConstants are the fractional parts of the cube roots of the first 64
+// primes.
+var roundConstants = [64]uint32{
+	0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5,
+	0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3, 0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174,
+	0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+	0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967,
+	0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13, 0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85,
+	0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+	0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3,
+	0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208, 0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2,
+}
+
+// Sha256 accumulates a big-endian bitstream via Write, padding and
+// processing one 512-bit block at a time, and produces the 256-bit
+// big-endian digest via Sum. nbBits passed to NewSha256 must equal the
+// total number of bits that will be written, since that length (not merely
+// the bits seen so far) is what SHA-256 padding commits to.
+type Sha256 struct {
+	api     frontend.API
+	nbBits  int
+	written int
+	buf     []frontend.Variable
+	state   [8]word
+}
+
+// NewSha256 returns a Sha256 gadget expecting exactly nbBits of input across
+// however many calls to Write, matching keccak.NewKeccak256's shape.
+func NewSha256(api frontend.API, nbBits int) *Sha256 {
+	h := &Sha256{api: api, nbBits: nbBits}
+	for i, v := range iv {
+		h.state[i] = uint32ToWord(api, v)
+	}
+	return h
+}
+
+// Write appends bits to the message, processing and discarding every full
+// 512-bit block as soon as it's available.
+func (h *Sha256) Write(bits ...frontend.Variable) {
+	h.buf = append(h.buf, bits...)
+	h.written += len(bits)
+	for len(h.buf) >= blockBits {
+		h.processBlock(h.buf[:blockBits])
+		h.buf = h.buf[blockBits:]
+	}
+}
+
+// Sum pads the remaining buffered bits per the SHA-256 spec (a 1 bit, zeros,
+// then the 64-bit big-endian bit length), processes the resulting final
+// block(s), and returns the 256-bit big-endian digest.
+func (h *Sha256) Sum() []frontend.Variable {
+	padded := append([]frontend.Variable{}, h.buf...)
+	padded = append(padded, bitConst(h.api, 1))
+	for (len(padded)+64)%blockBits != 0 {
+		padded = append(padded, bitConst(h.api, 0))
+	}
+	padded = append(padded, uint64ToBits(h.api, uint64(h.nbBits))...)
+
+	for len(padded) > 0 {
+		h.processBlock(padded[:blockBits])
+		padded = padded[blockBits:]
+	}
+
+	digest := make([]frontend.Variable, 0, 8*wordBits)
+	for _, w := range h.state {
+		digest = append(digest, w[:]...)
+	}
+	return digest
+}
+
+// processBlock runs one SHA-256 compression over a 512-bit block, updating
+// h.state in place.
+func (h *Sha256) processBlock(block []frontend.Variable) {
+	api := h.api
+
+	var schedule [64]word
+	for i := 0; i < 16; i++ {
+		copy(schedule[i][:], block[i*wordBits:(i+1)*wordBits])
+	}
+	for i := 16; i < 64; i++ {
+		s0 := xorWord(api, xorWord(api, rotr(schedule[i-15], 7), rotr(schedule[i-15], 18)), shr(schedule[i-15], 3))
+		s1 := xorWord(api, xorWord(api, rotr(schedule[i-2], 17), rotr(schedule[i-2], 19)), shr(schedule[i-2], 10))
+		schedule[i] = addWords(api, schedule[i-16], s0, schedule[i-7], s1)
+	}
+
+	a, b, c, d, e, f, g, hh := h.state[0], h.state[1], h.state[2], h.state[3], h.state[4], h.state[5], h.state[6], h.state[7]
+
+	for i := 0; i < 64; i++ {
+		bigS1 := xorWord(api, xorWord(api, rotr(e, 6), rotr(e, 11)), rotr(e, 25))
+		chWord := xorWord(api, andWord(api, e, f), andWord(api, notWord(api, e), g))
+		temp1 := addWords(api, hh, bigS1, chWord, uint32ToWord(api, roundConstants[i]), schedule[i])
+
+		bigS0 := xorWord(api, xorWord(api, rotr(a, 2), rotr(a, 13)), rotr(a, 22))
+		majWord := xorWord(api, xorWord(api, andWord(api, a, b), andWord(api, a, c)), andWord(api, b, c))
+		temp2 := addWords(api, bigS0, majWord)
+
+		hh = g
+		g = f
+		f = e
+		e = addWords(api, d, temp1)
+		d = c
+		c = b
+		b = a
+		a = addWords(api, temp1, temp2)
+	}
+
+	h.state[0] = addWords(api, h.state[0], a)
+	h.state[1] = addWords(api, h.state[1], b)
+	h.state[2] = addWords(api, h.state[2], c)
+	h.state[3] = addWords(api, h.state[3], d)
+	h.state[4] = addWords(api, h.state[4], e)
+	h.state[5] = addWords(api, h.state[5], f)
+	h.state[6] = addWords(api, h.state[6], g)
+	h.state[7] = addWords(api, h.state[7], hh)
+}
+
+// rotr rotates w right by n bits, the bitwise ROTR SHA-256's mixing
+// functions use (as opposed to shr, a plain logical shift).
+func rotr(w word, n int) word {
+	var out word
+	copy(out[:], w[wordBits-n:])
+	copy(out[n:], w[:wordBits-n])
+	return out
+}
+
+// shr logically shifts w right by n bits, filling the vacated high bits
+// with zero.
+func shr(w word, n int) word {
+	var out word
+	for i := 0; i < n; i++ {
+		out[i] = 0
+	}
+	copy(out[n:], w[:wordBits-n])
+	return out
+}
+
+func xorWord(api frontend.API, x, y word) word {
+	var out word
+	for i := range out {
+		out[i] = api.Xor(x[i], y[i])
+	}
+	return out
+}
+
+func andWord(api frontend.API, x, y word) word {
+	var out word
+	for i := range out {
+		out[i] = api.And(x[i], y[i])
+	}
+	return out
+}
+
+func notWord(api frontend.API, x word) word {
+	var out word
+	for i := range out {
+		out[i] = api.Sub(1, x[i])
+	}
+	return out
+}
+
+// addWords adds its arguments modulo 2^32, ripple-carrying from the least
+// significant bit (index wordBits-1) up to the most significant (index 0),
+// discarding the final carry out of the word.
+func addWords(api frontend.API, words ...word) word {
+	var out word
+	carry := frontend.Variable(0)
+	for i := wordBits - 1; i >= 0; i-- {
+		sum := carry
+		for _, w := range words {
+			sum = api.Add(sum, w[i])
+		}
+		bits := api.ToBinary(sum, bitsNeeded(2*len(words)-1))
+		out[i] = bits[0]
+		carry = api.FromBinary(bits[1:]...)
+	}
+	return out
+}
+
+// bitsNeeded returns how many bits are needed to represent maxValue. addWords
+// passes the largest sum it can produce at one bit position: up to len(words)
+// addends of value 1 plus the incoming carry, which is at most len(words)-1.
+func bitsNeeded(maxValue int) int {
+	n := 1
+	for (1 << uint(n)) <= maxValue {
+		n++
+	}
+	return n
+}
+
+func uint32ToWord(api frontend.API, v uint32) word {
+	var out word
+	for i := 0; i < wordBits; i++ {
+		if v&(1<<uint(wordBits-1-i)) != 0 {
+			out[i] = bitConst(api, 1)
+		} else {
+			out[i] = bitConst(api, 0)
+		}
+	}
+	return out
+}
+
+func uint64ToBits(api frontend.API, v uint64) []frontend.Variable {
+	bits := make([]frontend.Variable, 64)
+	for i := 0; i < 64; i++ {
+		if v&(1<<uint(63-i)) != 0 {
+			bits[i] = bitConst(api, 1)
+		} else {
+			bits[i] = bitConst(api, 0)
+		}
+	}
+	return bits
+}
+
+func bitConst(_ frontend.API, v int) frontend.Variable {
+	return frontend.Variable(v)
+}
@@ -0,0 +1,159 @@
+package prover
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ExportSolidityVerifier writes a Solidity verifier contract for ps to w,
+// wired to the same HashToField strategy ps was set up with. Callers that
+// changed HashToField away from the default must use this instead of the
+// underlying gnark ExportSolidity, or the on-chain public-input hashing
+// won't agree with what the circuit checked.
+func (ps *ProvingSystem) ExportSolidityVerifier(w io.Writer) error {
+	var buf bytes.Buffer
+	switch ps.Backend {
+	case BackendGroth16:
+		if err := ps.VerifyingKey.ExportSolidity(&buf); err != nil {
+			return fmt.Errorf("exporting groth16 verifier: %w", err)
+		}
+	case BackendPLONK:
+		if err := ps.Plonk.VerifyingKey.ExportSolidity(&buf); err != nil {
+			return fmt.Errorf("exporting plonk verifier: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown backend: %d", ps.Backend)
+	}
+
+	wired, err := wireHashToField(buf.String(), ps.Backend, ps.HashToField)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, wired)
+	return err
+}
+
+// wireHashToField splices a hashToField helper into the gnark-generated
+// contract, just before its closing brace, so it becomes part of the
+// contract rather than free-standing source a caller has to wire up by
+// hand. For Groth16 it also adds a verifyProofWithData overload that hashes
+// the caller's pre-image with strategy and forwards to the generated
+// verifyProof, so the entrypoint callers actually reach agrees with what
+// the circuit asserted into InputHash.
+//
+// PLONK verifier templates vary their entrypoint signature across gnark
+// versions, so for BackendPLONK only the helper is spliced in; callers hash
+// their pre-image with it before calling the generated verifier themselves.
+func wireHashToField(contract string, backend Backend, strategy HashToField) (string, error) {
+	helper, err := hashToFieldSolidityHelper(strategy)
+	if err != nil {
+		return "", err
+	}
+
+	addition := helper
+	if backend == BackendGroth16 {
+		wrapper, err := verifyProofWithDataSolidity(strategy)
+		if err != nil {
+			return "", err
+		}
+		addition += wrapper
+	}
+
+	lastBrace := strings.LastIndex(contract, "}")
+	if lastBrace == -1 {
+		return "", fmt.Errorf("gnark solidity output has no closing brace to splice into")
+	}
+	return contract[:lastBrace] + addition + contract[lastBrace:], nil
+}
+
+// hashToFieldSolidityHelper returns the Solidity source for a
+// hashToField(...) function matching strategy, so the deployed verifier's
+// public-input hashing agrees with what the circuit asserted.
+func hashToFieldSolidityHelper(strategy HashToField) (string, error) {
+	switch strategy {
+	case HashToFieldKeccak256BE:
+		return keccak256SolidityHelper, nil
+	case HashToFieldSHA256BE:
+		return sha256SolidityHelper, nil
+	case HashToFieldPoseidon:
+		return poseidonSolidityHelper, nil
+	default:
+		return "", fmt.Errorf("unknown hash-to-field strategy: %d", strategy)
+	}
+}
+
+// verifyProofWithDataSolidity returns a verifyProofWithData overload for the
+// classic gnark Groth16 verifyProof(a, b, c, input) signature, taking the
+// strategy's raw pre-image instead of a pre-hashed public input.
+func verifyProofWithDataSolidity(strategy HashToField) (string, error) {
+	switch strategy {
+	case HashToFieldKeccak256BE, HashToFieldSHA256BE:
+		return verifyProofWithBytesSolidity, nil
+	case HashToFieldPoseidon:
+		return verifyProofWithElementsSolidity, nil
+	default:
+		return "", fmt.Errorf("unknown hash-to-field strategy: %d", strategy)
+	}
+}
+
+const keccak256SolidityHelper = `
+// hashToField reduces keccak256(data) into the scalar field, mirroring
+// HashToFieldKeccak256BE.
+function hashToField(bytes memory data) internal pure returns (uint256) {
+    return uint256(keccak256(data)) % SNARK_SCALAR_FIELD;
+}
+`
+
+const sha256SolidityHelper = `
+// hashToField reduces sha256(data) into the scalar field, mirroring
+// HashToFieldSHA256BE.
+function hashToField(bytes memory data) internal view returns (uint256) {
+    return uint256(sha256(data)) % SNARK_SCALAR_FIELD;
+}
+`
+
+const poseidonSolidityHelper = `
+// hashToField mirrors HashToFieldPoseidon: the caller passes the field
+// elements the circuit folded, in the same order, since Poseidon operates
+// on field elements rather than bytes. This requires the
+// PoseidonT{N} library the rest of the deployment already links against.
+function hashToField(uint256[] memory elements) internal pure returns (uint256) {
+    uint256 acc = elements[0];
+    for (uint256 i = 1; i < elements.length; i++) {
+        acc = PoseidonT3.poseidon([acc, elements[i]]);
+    }
+    return acc;
+}
+`
+
+const verifyProofWithBytesSolidity = `
+// verifyProofWithData hashes data with hashToField and forwards the result
+// as the single public input verifyProof expects, so callers never have to
+// reproduce InputHash's hashing themselves.
+function verifyProofWithData(
+    uint256[2] memory a,
+    uint256[2][2] memory b,
+    uint256[2] memory c,
+    bytes memory data
+) public view returns (bool) {
+    uint256[1] memory input = [hashToField(data)];
+    return verifyProof(a, b, c, input);
+}
+`
+
+const verifyProofWithElementsSolidity = `
+// verifyProofWithData hashes elements with hashToField and forwards the
+// result as the single public input verifyProof expects, so callers never
+// have to reproduce InputHash's hashing themselves.
+function verifyProofWithData(
+    uint256[2] memory a,
+    uint256[2][2] memory b,
+    uint256[2] memory c,
+    uint256[] memory elements
+) public view returns (bool) {
+    uint256[1] memory input = [hashToField(elements)];
+    return verifyProof(a, b, c, input);
+}
+`
@@ -0,0 +1,119 @@
+package prover
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestWireHashToFieldSplicesIntoRealContract exercises wireHashToField
+// against a real gnark-emitted verifier contract (rather than a synthetic
+// stand-in), for every HashToField/Backend combination: 53ab088 fixed a
+// real bug in this exact splice logic (appending the helper as dead code
+// after the contract's closing brace instead of inside it), so asserting
+// only that wireHashToField returns no error isn't enough — it must also
+// assert the helper/overload text actually landed inside the contract body.
+func TestWireHashToFieldSplicesIntoRealContract(t *testing.T) {
+	ps, err := SetupInsertion(2, 1, BackendGroth16, false, HashToFieldKeccak256BE, "")
+	if err != nil {
+		t.Fatalf("SetupInsertion: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := ps.VerifyingKey.ExportSolidity(&buf); err != nil {
+		t.Fatalf("ExportSolidity: %v", err)
+	}
+	baseContract := buf.String()
+	if !strings.Contains(baseContract, "function verifyProof(") {
+		t.Fatalf("test fixture assumption broken: gnark's own Groth16 export no longer contains verifyProof(...)")
+	}
+
+	for _, backend := range []Backend{BackendGroth16, BackendPLONK} {
+		for _, strategy := range []HashToField{HashToFieldKeccak256BE, HashToFieldSHA256BE, HashToFieldPoseidon} {
+			t.Run(backend.String()+"/"+strategy.String(), func(t *testing.T) {
+				wired, err := wireHashToField(baseContract, backend, strategy)
+				if err != nil {
+					t.Fatalf("wireHashToField: %v", err)
+				}
+
+				if !strings.Contains(wired, "function hashToField(") {
+					t.Fatal("wired contract is missing the hashToField helper")
+				}
+				if !strings.HasPrefix(wired, baseContract[:strings.LastIndex(baseContract, "}")]) {
+					t.Fatal("wireHashToField altered the contract ahead of its closing brace instead of only inserting before it")
+				}
+				if !strings.HasSuffix(wired, "}") {
+					t.Fatal("wireHashToField dropped the contract's final closing brace")
+				}
+
+				hasWrapper := strings.Contains(wired, "function verifyProofWithData(")
+				switch backend {
+				case BackendGroth16:
+					if !hasWrapper {
+						t.Fatal("Groth16 output is missing the verifyProofWithData overload")
+					}
+				case BackendPLONK:
+					if hasWrapper {
+						t.Fatal("PLONK output unexpectedly contains a verifyProofWithData overload (documented as Groth16-only)")
+					}
+				}
+
+				if depth := braceDepth(wired); depth != 0 {
+					t.Fatalf("wired contract has unbalanced braces (net depth %d)", depth)
+				}
+			})
+		}
+	}
+}
+
+// TestExportSolidityVerifierRoundTrip checks ExportSolidityVerifier end to
+// end for both backends, rather than only unit-testing the splice helper it
+// calls: a regression in how ExportSolidityVerifier picks the right
+// VerifyingKey (Groth16 vs Plonk.VerifyingKey) per ps.Backend wouldn't be
+// caught by TestWireHashToFieldSplicesIntoRealContract alone.
+func TestExportSolidityVerifierRoundTrip(t *testing.T) {
+	for _, backend := range []Backend{BackendGroth16, BackendPLONK} {
+		t.Run(backend.String(), func(t *testing.T) {
+			var srsPath string
+			if backend == BackendPLONK {
+				ccs, err := BuildSCSInsertion(2, 1)
+				if err != nil {
+					t.Fatalf("BuildSCSInsertion: %v", err)
+				}
+				srsPath = writeUnsafeTestSRS(t, ccs)
+			}
+
+			ps, err := SetupInsertion(2, 1, backend, false, HashToFieldSHA256BE, srsPath)
+			if err != nil {
+				t.Fatalf("SetupInsertion: %v", err)
+			}
+
+			var out bytes.Buffer
+			if err := ps.ExportSolidityVerifier(&out); err != nil {
+				t.Fatalf("ExportSolidityVerifier: %v", err)
+			}
+
+			contract := out.String()
+			if !strings.Contains(contract, "function hashToField(") {
+				t.Fatal("exported contract is missing the hashToField helper")
+			}
+			if depth := braceDepth(contract); depth != 0 {
+				t.Fatalf("exported contract has unbalanced braces (net depth %d)", depth)
+			}
+		})
+	}
+}
+
+// braceDepth returns the net nesting depth of curly braces in s: zero means
+// every opening brace in s has a matching close.
+func braceDepth(s string) int {
+	depth := 0
+	for _, r := range s {
+		switch r {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		}
+	}
+	return depth
+}
@@ -0,0 +1,103 @@
+package prover
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/kzg"
+	"github.com/consensys/gnark/constraint"
+)
+
+// srsCacheKey disambiguates cached SRS entries by curve as well as tree
+// depth: the BN254 batch circuits and the BW6-761 aggregation circuit both
+// go through universalSRS, and aggregation always calls it with treeDepth 0,
+// so depth alone would collide the two curves' SRS together.
+type srsCacheKey struct {
+	curve     ecc.ID
+	treeDepth uint32
+}
+
+// srsDomainSize rounds n up to the next power of two, matching the size of
+// the FFT domain plonk.Setup builds from a constraint system's constraint
+// count. The cached Lagrange-basis SRS is tied to that domain specifically
+// (its elements are evaluations of that domain's Lagrange basis polynomials
+// at the ceremony's tau, not a prefix-truncatable list like the canonical
+// basis is), so two constraint counts only share a reusable entry if they
+// round up to the same domain size.
+func srsDomainSize(n int) int {
+	size := 1
+	for size < n {
+		size *= 2
+	}
+	return size
+}
+
+// srsCache holds one universal KZG SRS per (curve, tree depth) pair, shared
+// across every batch size whose constraint count rounds up to the same FFT
+// domain for that pair. A size miss reloads and replaces the cached entry
+// from srsPath entirely rather than growing it in place.
+var (
+	srsCacheMu sync.Mutex
+	srsCache   = map[srsCacheKey]struct {
+		srs         kzg.SRS
+		srsLagrange kzg.SRS
+		domainSize  int
+	}{}
+)
+
+// universalSRS returns a KZG SRS for ccs's FFT domain, loading it from the
+// ceremony-derived SRS file at srsPath, or reusing the entry already cached
+// for ccs's curve and treeDepth if that entry was built for the same domain
+// size (see srsDomainSize).
+//
+// There is deliberately no fallback to an unsafe locally-generated SRS here:
+// doing so silently in a production code path would mean whichever process
+// runs Setup first mints toxic waste that never gets discarded, and proofs
+// built on it can be forged. Callers that want that behaviour for tests
+// should generate their own SRS with test/unsafekzg and pass the resulting
+// file's path in, keeping the "this is unsafe" opt-in explicit and confined
+// to test code.
+func universalSRS(treeDepth uint32, batchSize uint32, curve ecc.ID, srsPath string, ccs constraint.ConstraintSystem) (kzg.SRS, kzg.SRS, error) {
+	if srsPath == "" {
+		return nil, nil, fmt.Errorf("no SRS path provided for depth %d, batch size %d: a ceremony-derived universal SRS is required", treeDepth, batchSize)
+	}
+
+	srsCacheMu.Lock()
+	defer srsCacheMu.Unlock()
+
+	domainSize := srsDomainSize(ccs.GetNbConstraints())
+
+	key := srsCacheKey{curve: curve, treeDepth: treeDepth}
+	entry, ok := srsCache[key]
+	if ok && entry.domainSize == domainSize {
+		return entry.srs, entry.srsLagrange, nil
+	}
+
+	f, err := os.Open(srsPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening SRS file %q for depth %d, batch size %d: %w", srsPath, treeDepth, batchSize, err)
+	}
+	defer f.Close()
+
+	// The ceremony file stores the canonical-basis SRS followed by its
+	// Lagrange-basis counterpart, the same pair unsafekzg.NewSRS produces
+	// and plonk.Setup consumes.
+	newSRS := kzg.NewSRS(curve)
+	if _, err := newSRS.ReadFrom(f); err != nil {
+		return nil, nil, fmt.Errorf("reading canonical SRS from %q for depth %d, batch size %d: %w", srsPath, treeDepth, batchSize, err)
+	}
+	newSRSLagrange := kzg.NewSRS(curve)
+	if _, err := newSRSLagrange.ReadFrom(f); err != nil {
+		return nil, nil, fmt.Errorf("reading Lagrange SRS from %q for depth %d, batch size %d: %w", srsPath, treeDepth, batchSize, err)
+	}
+
+	srsCache[key] = struct {
+		srs         kzg.SRS
+		srsLagrange kzg.SRS
+		domainSize  int
+	}{newSRS, newSRSLagrange, domainSize}
+
+	return newSRS, newSRSLagrange, nil
+}
@@ -0,0 +1,137 @@
+package prover
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/scs"
+	"github.com/consensys/gnark/test/unsafekzg"
+)
+
+// writeUnsafeTestSRS generates a toxic-waste SRS sized for ccs and writes it
+// (canonical basis followed by Lagrange basis, the layout universalSRS
+// expects) to a temp file, returning its path. This is exactly the kind of
+// test-only escape hatch universalSRS's doc comment describes: fine for
+// exercising SetupInsertion/SetupDeletion/ProveAggregate here, never fine as
+// a fallback in the production path itself.
+func writeUnsafeTestSRS(t *testing.T, ccs constraint.ConstraintSystem) string {
+	t.Helper()
+
+	srs, srsLagrange, err := unsafekzg.NewSRS(ccs)
+	if err != nil {
+		t.Fatalf("unsafekzg.NewSRS: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "srs")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("creating SRS file: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := srs.WriteTo(f); err != nil {
+		t.Fatalf("writing canonical SRS: %v", err)
+	}
+	if _, err := srsLagrange.WriteTo(f); err != nil {
+		t.Fatalf("writing Lagrange SRS: %v", err)
+	}
+
+	return path
+}
+
+// TestUniversalSRSRequiresPath ensures the production path no longer falls
+// back to an unsafe locally-generated SRS: an empty srsPath must error
+// rather than silently minting toxic waste.
+func TestUniversalSRSRequiresPath(t *testing.T) {
+	ccs, err := BuildSCSInsertion(2, 1)
+	if err != nil {
+		t.Fatalf("BuildSCSInsertion: %v", err)
+	}
+	if _, _, err := universalSRS(2, 1, ecc.BN254, "", ccs); err == nil {
+		t.Fatal("expected an error for an empty SRS path, got none")
+	}
+}
+
+// TestUniversalSRSCacheKeyedByCurve guards against the cache collision that
+// keying solely by treeDepth caused: the BN254 batch circuits and the
+// BW6-761 aggregation circuit both call universalSRS with treeDepth 0 for
+// aggregation, or can otherwise land on the same depth by coincidence, so an
+// entry cached for one curve must never be handed back for another.
+func TestUniversalSRSCacheKeyedByCurve(t *testing.T) {
+	const depth = 5
+
+	bn254CCS, err := BuildSCSInsertion(2, 1)
+	if err != nil {
+		t.Fatalf("BuildSCSInsertion: %v", err)
+	}
+	bn254Path := writeUnsafeTestSRS(t, bn254CCS)
+	bn254SRS, _, err := universalSRS(depth, 1, ecc.BN254, bn254Path, bn254CCS)
+	if err != nil {
+		t.Fatalf("universalSRS (BN254): %v", err)
+	}
+
+	bw6CCS, err := frontend.Compile(ecc.BW6_761.ScalarField(), scs.NewBuilder, &publicInputHashCircuit{})
+	if err != nil {
+		t.Fatalf("compiling BW6-761 circuit: %v", err)
+	}
+	bw6Path := writeUnsafeTestSRS(t, bw6CCS)
+	bw6SRS, _, err := universalSRS(depth, 1, ecc.BW6_761, bw6Path, bw6CCS)
+	if err != nil {
+		t.Fatalf("universalSRS (BW6-761): %v", err)
+	}
+
+	if bn254SRS == bw6SRS {
+		t.Fatal("universalSRS returned the same cached entry for two different curves at the same tree depth")
+	}
+}
+
+// TestUniversalSRSReloadsAcrossDomainBoundary guards against reusing a
+// cached Lagrange-basis SRS for the wrong FFT domain: entry.size >=
+// ccs.GetNbConstraints() alone doesn't imply the domains match, since
+// domain size is nbConstraints rounded up to the next power of two. A
+// smaller batch whose constraint count still rounds up to the same domain
+// as a previously-cached larger batch must reuse that entry; one that
+// rounds up to a different domain must not.
+func TestUniversalSRSReloadsAcrossDomainBoundary(t *testing.T) {
+	const depth = 3
+
+	smallCCS, err := BuildSCSInsertion(depth, 1)
+	if err != nil {
+		t.Fatalf("BuildSCSInsertion(batchSize=1): %v", err)
+	}
+	smallPath := writeUnsafeTestSRS(t, smallCCS)
+	smallDomain := srsDomainSize(smallCCS.GetNbConstraints())
+
+	largeCCS, err := BuildSCSInsertion(depth, 8)
+	if err != nil {
+		t.Fatalf("BuildSCSInsertion(batchSize=8): %v", err)
+	}
+	largeDomain := srsDomainSize(largeCCS.GetNbConstraints())
+	if largeDomain == smallDomain {
+		t.Fatalf("test batch sizes landed in the same FFT domain (%d); pick sizes that straddle a power-of-two boundary", smallDomain)
+	}
+	largePath := writeUnsafeTestSRS(t, largeCCS)
+
+	if _, _, err := universalSRS(depth, 1, ecc.BN254, smallPath, smallCCS); err != nil {
+		t.Fatalf("universalSRS (small): %v", err)
+	}
+	largeSRS, largeSRSLagrange, err := universalSRS(depth, 8, ecc.BN254, largePath, largeCCS)
+	if err != nil {
+		t.Fatalf("universalSRS (large): %v", err)
+	}
+
+	// Asking for the small domain again must not hand back the entry sized
+	// for the large domain: that Lagrange basis belongs to a different set
+	// of roots of unity and isn't valid for the small circuit's domain.
+	reloadedSRS, reloadedSRSLagrange, err := universalSRS(depth, 1, ecc.BN254, smallPath, smallCCS)
+	if err != nil {
+		t.Fatalf("universalSRS (small, reloaded): %v", err)
+	}
+	if reloadedSRS == largeSRS || reloadedSRSLagrange == largeSRSLagrange {
+		t.Fatal("universalSRS reused the large domain's cached SRS for a smaller, differently-domained circuit")
+	}
+}